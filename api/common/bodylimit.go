@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package common
+
+import (
+	"io"
+	nethttp "net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oceanbase/obagent/errors"
+	"github.com/oceanbase/obagent/lib/http"
+	"github.com/oceanbase/obagent/lib/trace"
+)
+
+// DefaultMaxRequestBodyBytes is the default max size of a request body, large enough for any config or command.
+const DefaultMaxRequestBodyBytes = 32 << 20
+
+const requestBodyKey = "requestBody"
+
+// BodyLimitHandler limits the size of request bodies to limit bytes. A request declaring a larger Content-Length
+// is rejected at once, a request found larger while reading its body gets a 413 response by PostHandlers.
+// It should be used before PreHandlers, which reads the body for logging.
+func BodyLimitHandler(limit int64) func(*gin.Context) {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			log.WithContext(trace.ContextWithTraceId(c.Request)).Warnf("API request body too large: [%v %v, client=%v, contentLength=%v, limit=%v]",
+				c.Request.Method, c.Request.URL, c.ClientIP(), c.Request.ContentLength, limit)
+			resp := http.BuildResponse(nil, errors.Occur(errors.ErrRequestTooLarge, limit))
+			resp.TraceId = trace.GetTraceId(c.Request)
+			c.AbortWithStatusJSON(resp.Status, resp)
+			return
+		}
+		if c.Request.Body == nil {
+			c.Next()
+			return
+		}
+		body := &limitedBody{
+			ReadCloser: nethttp.MaxBytesReader(c.Writer, c.Request.Body, limit),
+			limit:      limit,
+		}
+		c.Request.Body = body
+		c.Set(requestBodyKey, body)
+		c.Next()
+	}
+}
+
+// limitedBody records whether the body exceeds the limit while it is read.
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	// MaxBytesReader returns a MaxBytesError when the limit is exceeded, other errors of the body,
+	// e.g. the client disconnected or a truncated chunked body, are passed through as is
+	var maxBytesErr *nethttp.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// requestBodyTooLarge returns the error to respond if the body of the request exceeded its limit.
+func requestBodyTooLarge(c *gin.Context) error {
+	if v, ok := c.Get(requestBodyKey); ok {
+		if body, ok := v.(*limitedBody); ok && body.exceeded {
+			return errors.Occur(errors.ErrRequestTooLarge, body.limit)
+		}
+	}
+	return nil
+}
@@ -26,7 +26,8 @@ import (
 func UpdateConfigPropertiesHandler(c *gin.Context) {
 	kvs := config.KeyValues{}
 	c.Bind(&kvs)
-	ctx := NewContextWithTraceId(c)
+	// the notified modules, e.g. the pipelines, keep the context after the response is sent
+	ctx := NewTaskContextWithTraceId(c)
 	ctxlog := log.WithContext(ctx)
 
 	configVersion, err := config.UpdateConfig(ctx, &kvs)
@@ -46,7 +47,8 @@ func NotifyConfigPropertiesHandler(c *gin.Context) {
 	nconfig := new(config.NotifyModuleConfig)
 	c.Bind(nconfig)
 
-	ctx := NewContextWithTraceId(c)
+	// the notified modules, e.g. the pipelines, keep the context after the response is sent
+	ctx := NewTaskContextWithTraceId(c)
 	ctxlog := log.WithContext(ctx).WithFields(log.Fields{
 		"process":            nconfig.Process,
 		"module":             nconfig.Module,
@@ -94,7 +96,8 @@ func ConfigStatusHandler(c *gin.Context) {
 }
 
 func ReloadConfigHandler(c *gin.Context) {
-	ctx := NewContextWithTraceId(c)
+	// the notified modules keep the context after the response is sent
+	ctx := NewTaskContextWithTraceId(c)
 	ctxlog := log.WithContext(ctx)
 	err := mgragent.GlobalConfigManager.ReloadModuleConfigs(ctx)
 	if err != nil {
@@ -115,7 +118,8 @@ func ChangeConfigHandler(c *gin.Context) {
 	req := mgragent.ModuleConfigChangeRequest{
 		Reload: true,
 	}
-	ctx := NewContextWithTraceId(c)
+	// the notified modules keep the context after the response is sent
+	ctx := NewTaskContextWithTraceId(c)
 	ctxlog := log.WithContext(ctx)
 
 	err := c.BindJSON(&req)
@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultGzipThreshold is the min size of a response body to compress.
+const DefaultGzipThreshold = 1024
+
+// compressedContentTypes are the content types that are compressed already, compressing them again saves nothing.
+var compressedContentTypes = []string{
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/x-xz",
+	"application/zstd",
+	"image/",
+	"video/",
+}
+
+// GzipHandler compresses the response with gzip if the client accepts it and the body is at least threshold bytes.
+// The body is buffered until it reaches the threshold, so that small responses are sent as is.
+// Responses with Content-Encoding set by the handler or of a compressed content type are never compressed.
+// It should be used before PostHandlers, so that the response built from OcpAgentResponseKey is compressed as well.
+func GzipHandler(threshold int) func(*gin.Context) {
+	return func(c *gin.Context) {
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) || c.Request.Method == "HEAD" {
+			c.Next()
+			return
+		}
+		w := &gzipResponseWriter{ResponseWriter: c.Writer, threshold: threshold}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	threshold int
+	buf       bytes.Buffer
+	decided   bool // whether to compress is decided, the buffered body is flushed then
+	gz        *gzip.Writer
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buf.Write(data)
+		if w.buf.Len() < w.threshold {
+			return len(data), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow delays writing the header until whether to compress is decided.
+func (w *gzipResponseWriter) WriteHeaderNow() {
+	if w.decided {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Flush decides to compress the body as it is likely to be a long stream, and flushes what is compressed so far.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(true)
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *gzipResponseWriter) Written() bool {
+	return w.decided && w.ResponseWriter.Written()
+}
+
+// decide writes the header and the buffered body, compressed if compress is true and the body is not compressed yet.
+func (w *gzipResponseWriter) decide(compress bool) error {
+	w.decided = true
+	header := w.Header()
+	if compress && header.Get("Content-Encoding") == "" && !isCompressedContentType(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", "gzip")
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+// finish sends the body buffered below the threshold as is, or completes the compressed body.
+func (w *gzipResponseWriter) finish() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	if w.gz != nil {
+		_ = w.gz.Close()
+	}
+}
+
+// acceptsGzip reports whether gzip is acceptable by Accept-Encoding, i.e. its q weight is not 0.
+func acceptsGzip(acceptEncoding string) bool {
+	return quality(parseAccept(acceptEncoding), "gzip") > 0
+}
+
+func isCompressedContentType(contentType string) bool {
+	for _, t := range compressedContentTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -16,8 +16,12 @@ import (
 	"context"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 
+	"github.com/oceanbase/obagent/errors"
 	"github.com/oceanbase/obagent/lib/http"
+	"github.com/oceanbase/obagent/lib/mask"
+	"github.com/oceanbase/obagent/lib/shell"
 	"github.com/oceanbase/obagent/log"
 )
 
@@ -26,19 +30,82 @@ const (
 	OcpAgentResponseKey = "ocpAgentResponse"
 	TraceIdKey          = "traceId"
 	OcpServerIpKey      = "ocpServerIp"
+	RequestContextKey   = "requestContext"
+	ActorKey            = "actor"
+	ClaimedOperatorKey  = "claimedOperator"
+	RequestStartTimeKey = "requestStartTime"
+	UnmaskedKey         = "unmasked"
 )
 
+// NewContextWithTraceId returns a context carrying the traceId of the request,
+// and the deadline of the request if it is limited by TimeoutHandler.
+// Masking is disabled by the context if the request is accepted by UnmaskDebugHandler.
 func NewContextWithTraceId(c *gin.Context) context.Context {
+	parent := context.Background()
+	if v, ok := c.Get(RequestContextKey); ok {
+		if ctx, ok := v.(context.Context); ok {
+			parent = ctx
+		}
+	}
+	return withRequestValues(c, parent)
+}
+
+// NewTaskContextWithTraceId returns a context like NewContextWithTraceId, but not limited by the request,
+// for the async tasks that keep running after the response is sent.
+func NewTaskContextWithTraceId(c *gin.Context) context.Context {
+	return withRequestValues(c, context.Background())
+}
+
+func withRequestValues(c *gin.Context, parent context.Context) context.Context {
+	// the defaults of shell commands set by ShellDefaultsHandler are carried by the context of the request
+	if c.Request != nil {
+		if defaults, ok := shell.ExecuteDefaultsFromContext(c.Request.Context()); ok {
+			parent = shell.WithExecuteDefaults(parent, defaults)
+		}
+	}
 	traceId := ""
 	if t, ok := c.Get(TraceIdKey); ok {
 		if ts, ok := t.(string); ok {
 			traceId = ts
 		}
 	}
-	return context.WithValue(context.Background(), log.TraceIdKey{}, traceId)
+	ctx := context.WithValue(parent, log.TraceIdKey{}, traceId)
+	if actor := c.GetString(ActorKey); actor != "" {
+		ctx = context.WithValue(ctx, log.ActorKey{}, actor)
+	}
+	if operator := c.GetString(ClaimedOperatorKey); operator != "" {
+		ctx = context.WithValue(ctx, log.ClaimedOperatorKey{}, operator)
+	}
+	if c.GetBool(UnmaskedKey) {
+		ctx = mask.WithUnmasked(ctx)
+	}
+	return ctx
 }
 
 func SendResponse(c *gin.Context, data interface{}, err error) {
 	resp := http.BuildResponse(data, err)
 	c.Set(OcpAgentResponseKey, resp)
 }
+
+// SendResponseWithStatus sends the response like SendResponse, but with the HTTP status set explicitly,
+// e.g. 201 for created or 202 for accepted. The status is used for both the HTTP response and the Status of the body
+// on success, a failed request keeps the status of its error.
+func SendResponseWithStatus(c *gin.Context, status int, data interface{}, err error) {
+	resp := http.BuildResponse(data, err)
+	if err == nil {
+		resp.Status = status
+	}
+	c.Set(OcpAgentResponseKey, resp)
+}
+
+// SendBindError sends the error of binding the request by ShouldBind and its variants.
+// Validation errors are sent as a bad request with a structured error of each field,
+// other errors, e.g. malformed JSON, are sent as a bad request too.
+func SendBindError(c *gin.Context, err error) {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		SendResponse(c, nil, validationErrors)
+		return
+	}
+	SendResponse(c, nil, errors.Occur(errors.ErrBadRequest, err))
+}
@@ -13,6 +13,7 @@
 package common
 
 import (
+	nethttp "net/http"
 	"os"
 	"time"
 
@@ -20,7 +21,9 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/oceanbase/obagent/config"
+	"github.com/oceanbase/obagent/errors"
 	"github.com/oceanbase/obagent/lib/http"
+	"github.com/oceanbase/obagent/lib/shell"
 	"github.com/oceanbase/obagent/lib/system"
 )
 
@@ -36,8 +39,14 @@ func GitInfoHandler(c *gin.Context) {
 	SendResponse(c, config.GetGitInfo(), nil)
 }
 
+// ActiveCommandsHandler responds the shell commands the agent is running, with their pids, start time and trace ids.
+func ActiveCommandsHandler(c *gin.Context) {
+	SendResponse(c, shell.ActiveCommands(), nil)
+}
+
 var StartAt = time.Now().UnixNano()
 var libProcess system.Process = system.ProcessImpl{}
+var libShell shell.Shell = shell.ShellImpl{}
 
 func StatusHandler(s *http.StateHolder) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -60,3 +69,26 @@ func StatusHandler(s *http.StateHolder) gin.HandlerFunc {
 		SendResponse(c, info, nil)
 	}
 }
+
+const healthCheckTimeout = 5 * time.Second
+
+// HealthHandler reports that the agent is alive with its version and uptime, it has no side effect.
+// With query parameter deep=true, it also executes a cheap shell command to check that commands can be executed,
+// and responds 503 if they can not.
+func HealthHandler(c *gin.Context) {
+	health := http.Health{
+		Version: config.AgentVersion,
+		Uptime:  int64(time.Since(time.Unix(0, StartAt)) / time.Second),
+	}
+	if c.Query("deep") == "true" {
+		ctx := NewContextWithTraceId(c)
+		_, err := libShell.NewCommand("echo ok").WithContext(ctx).WithTimeout(healthCheckTimeout).Execute()
+		if err != nil {
+			log.WithContext(ctx).Errorf("health check execute shell command failed, err: %v", err)
+			SendResponse(c, nil, errors.NewAgentError(errors.ErrExecuteCommand.Code, nethttp.StatusServiceUnavailable, err.Error()))
+			return
+		}
+		health.Exec = true
+	}
+	SendResponse(c, health, nil)
+}
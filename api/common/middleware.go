@@ -14,9 +14,11 @@ package common
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"regexp"
+	"runtime/debug"
 	"strings"
 	"time"
 
@@ -28,6 +30,7 @@ import (
 
 	"github.com/oceanbase/obagent/errors"
 	"github.com/oceanbase/obagent/lib/http"
+	"github.com/oceanbase/obagent/lib/shell"
 	"github.com/oceanbase/obagent/lib/system"
 	"github.com/oceanbase/obagent/lib/trace"
 	"github.com/oceanbase/obagent/stat"
@@ -42,13 +45,19 @@ const logQuerierURI = "/api/v1/log"
 // Before handlers, extract HTTP headers, and log the API request.
 func PreHandlers(maskBodyRoutes ...string) func(*gin.Context) {
 	return func(c *gin.Context) {
+		// the duration of the response counts from here, see PostHandlers
+		c.Set(RequestStartTimeKey, time.Now())
+
+		// Use traceId passed from OCP-Server for logging, or generate one if not passed,
+		// and echo it back so that the caller can correlate the response with server logs.
+		traceId := trace.GetTraceId(c.Request)
+		c.Set(TraceIdKey, traceId)
+		c.Header(trace.TraceIdHeader, traceId)
+
 		if c.Request.RequestURI == statusURI {
 			c.Next()
 			return
 		}
-		// Use traceId passed from OCP-Server for logging.
-		traceId := trace.GetTraceId(c.Request)
-		c.Set(TraceIdKey, traceId)
 
 		// Store OCP-Server's ip address for logging.
 		// c.ClientIP() may not be accurate if HTTP requests are forwarded by proxy server.
@@ -95,14 +104,21 @@ func SetContentType(c *gin.Context) {
 func getResponseFromContext(c *gin.Context) http.OcpAgentResponse {
 	ctx := NewContextWithTraceId(c)
 
+	// the handler got a truncated body, its response is not reliable
+	if err := requestBodyTooLarge(c); err != nil {
+		return http.BuildResponse(nil, err)
+	}
+
 	if len(c.Errors) > 0 {
 		var subErrors []interface{}
 		for _, e := range c.Errors {
 			switch e.Type {
 			case gin.ErrorTypeBind:
-				validationErrors := e.Err.(validator.ValidationErrors)
-				for _, fieldError := range validationErrors {
-					subErrors = append(subErrors, http.NewApiFieldError(fieldError))
+				// binding fails with validation errors, or other errors such as malformed JSON
+				if validationErrors, ok := e.Err.(validator.ValidationErrors); ok {
+					subErrors = append(subErrors, http.NewApiFieldErrors(validationErrors)...)
+				} else {
+					subErrors = append(subErrors, http.ApiUnknownError{Error: e.Err})
 				}
 			default:
 				subErrors = append(subErrors, http.ApiUnknownError{Error: e.Err})
@@ -121,20 +137,47 @@ func getResponseFromContext(c *gin.Context) http.OcpAgentResponse {
 	return http.NewErrorResponse(errors.Occur(errors.ErrUnexpected, "cannot build response body"))
 }
 
+// requestStartTime returns the time the request is received, recorded by PreHandlers, or def if it is not recorded.
+func requestStartTime(c *gin.Context, def time.Time) time.Time {
+	if v, ok := c.Get(RequestStartTimeKey); ok {
+		if t, ok := v.(time.Time); ok {
+			return t
+		}
+	}
+	return def
+}
+
+// accessLogFields returns the structured fields of the access log of a request,
+// so that the logs of a request and of the shell commands it executes can be correlated by the traceId of the context.
+func accessLogFields(c *gin.Context, status int, latency time.Duration) log.Fields {
+	return log.Fields{
+		"method":  c.Request.Method,
+		"path":    c.Request.URL.Path,
+		"status":  status,
+		"latency": latency,
+	}
+}
+
 // After handlers, build the complete OcpAgentResponse object,
 // log the API result, and send HTTP response.
+// The duration of the response counts from the time the request is received by PreHandlers if it is used before,
+// and the server timestamp is the time the response is sent.
+// Requests of excludeRoutes are passed through, and only the access log is written for them.
 func PostHandlers(excludeRoutes ...string) func(*gin.Context) {
 	localIpAddress, _ := libSystem.GetLocalIpAddress()
 	return func(c *gin.Context) {
+		startTime := requestStartTime(c, time.Now())
+
 		for _, it := range excludeRoutes {
 			if strings.HasPrefix(c.Request.RequestURI, it) {
 				c.Next()
+				log.WithContext(NewContextWithTraceId(c)).
+					WithFields(accessLogFields(c, c.Writer.Status(), time.Now().Sub(startTime))).
+					Infof("API response: [%v %v, client=%v]", c.Request.Method, c.Request.URL, c.ClientIP())
 				return
 			}
 		}
 
-		startTime := time.Now()
-
 		c.Next()
 
 		ctx := NewContextWithTraceId(c)
@@ -142,6 +185,7 @@ func PostHandlers(excludeRoutes ...string) func(*gin.Context) {
 
 		duration := time.Now().Sub(startTime)
 		resp.Duration = int(duration / time.Millisecond)
+		resp.ServerTimestamp = time.Now()
 
 		ocpServerIp, _ := c.Get(OcpServerIpKey)
 		if v, ok := c.Get(TraceIdKey); ok {
@@ -151,24 +195,29 @@ func PostHandlers(excludeRoutes ...string) func(*gin.Context) {
 		}
 
 		resp.Server = localIpAddress
+		entry := log.WithContext(ctx).WithFields(accessLogFields(c, resp.Status, duration))
 		if resp.Successful {
 			if c.Request.RequestURI != statusURI {
 				if strings.HasPrefix(c.Request.RequestURI, logQuerierURI) {
-					log.WithContext(ctx).Infof("API response OK: [%v %v, client=%v, ocpServerIp=%v, traceId=%v, duration=%v, status=%v]",
+					entry.Infof("API response OK: [%v %v, client=%v, ocpServerIp=%v, traceId=%v, duration=%v, status=%v]",
 						c.Request.Method, c.Request.URL, c.ClientIP(), ocpServerIp, resp.TraceId, duration, resp.Status)
 				} else {
-					log.WithContext(ctx).Infof("API response OK: [%v %v, client=%v, ocpServerIp=%v, traceId=%v, duration=%v, status=%v, data=%+v]",
+					entry.Infof("API response OK: [%v %v, client=%v, ocpServerIp=%v, traceId=%v, duration=%v, status=%v, data=%+v]",
 						c.Request.Method, c.Request.URL, c.ClientIP(), ocpServerIp, resp.TraceId, duration, resp.Status, resp.Data)
 				}
 			} else {
-				log.WithContext(ctx).Debugf("API response OK: [%v %v, client=%v, ocpServerIp=%v, traceId=%v, duration=%v, status=%v, data=%+v]",
+				entry.Debugf("API response OK: [%v %v, client=%v, ocpServerIp=%v, traceId=%v, duration=%v, status=%v, data=%+v]",
 					c.Request.Method, c.Request.URL, c.ClientIP(), ocpServerIp, resp.TraceId, duration, resp.Status, resp.Data)
 			}
 		} else {
-			log.WithContext(ctx).Infof("API response error: [%v %v, client=%v, ocpServerIp=%v, traceId=%v, duration=%v, status=%v, error=%v]",
+			entry.Infof("API response error: [%v %v, client=%v, ocpServerIp=%v, traceId=%v, duration=%v, status=%v, error=%v]",
 				c.Request.Method, c.Request.URL, c.ClientIP(), ocpServerIp, resp.TraceId, duration, resp.Status, resp.Error.String())
 		}
-		c.JSON(resp.Status, resp)
+		if c.GetBool(streamedResponseKey) {
+			// the response is sent by SendStreamResponse already
+			return
+		}
+		renderResponse(c, resp)
 	}
 }
 
@@ -213,6 +262,65 @@ func Recovery(c *gin.Context, err interface{}) {
 	log.WithContext(NewContextWithTraceId(c)).Errorf("request context %+v, err:%+v", c, err)
 }
 
+// DefaultRequestTimeout is the default time limit of a synchronous request, see TimeoutHandler.
+const DefaultRequestTimeout = 60 * time.Second
+
+// TimeoutHandler limits the time to handle a request of the route group it is used by.
+// The deadline is carried by the contexts built by NewContextWithTraceId, so that shell commands executed
+// with them are cancelled when it elapses, and the request gets a 503 response. It should be used after PostHandlers.
+// Async tasks and config changes kept by the modules must not be limited by it, see NewTaskContextWithTraceId.
+func TimeoutHandler(timeout time.Duration) func(*gin.Context) {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Set(RequestContextKey, ctx)
+
+		c.Next()
+
+		if ctx.Err() != context.DeadlineExceeded {
+			return
+		}
+		// a request finished successfully right before the deadline keeps its response
+		if r, ok := c.Get(OcpAgentResponseKey); ok {
+			if resp, ok := r.(http.OcpAgentResponse); ok && resp.Successful {
+				return
+			}
+		}
+		log.WithContext(NewContextWithTraceId(c)).Warnf("API request timeout: [%v %v, client=%v, timeout=%v]",
+			c.Request.Method, c.Request.URL, c.ClientIP(), timeout)
+		SendResponse(c, nil, errors.Occur(errors.ErrRequestTimeout, timeout))
+	}
+}
+
+// ShellDefaultsHandler makes the shell commands executed with the contexts built by NewContextWithTraceId
+// run with the defaults, e.g. as a user or with a timeout, unless the commands set their own, see shell.WithExecuteDefaults.
+// It should be used before TimeoutHandler.
+func ShellDefaultsHandler(defaults shell.ExecuteDefaults) func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(shell.WithExecuteDefaults(c.Request.Context(), defaults))
+		if v, ok := c.Get(RequestContextKey); ok {
+			if ctx, ok := v.(context.Context); ok {
+				c.Set(RequestContextKey, shell.WithExecuteDefaults(ctx, defaults))
+			}
+		}
+		c.Next()
+	}
+}
+
+// RecoveryHandler recovers a panic of the handlers after it and sends an unexpected error response,
+// so that the response built by PostHandlers still carries the traceId. It should be used after PostHandlers.
+func RecoveryHandler(c *gin.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.WithContext(NewContextWithTraceId(c)).Errorf("API request panic: [%v %v, client=%v], err:%v, stack:\n%s",
+				c.Request.Method, c.Request.URL, c.ClientIP(), err, debug.Stack())
+			c.Abort()
+			SendResponse(c, nil, errors.Occur(errors.ErrUnexpected, fmt.Sprintf("panic: %v", err)))
+		}
+	}()
+	c.Next()
+}
+
 func IgnoreFaviconHandler(c *gin.Context) {
 	if c.Request.URL.Path == "/favicon.ico" {
 		c.Abort()
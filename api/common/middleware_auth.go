@@ -34,6 +34,11 @@ const (
 	HmacSHA256      string = "OCP-HMACSHA256"
 	TRACE_ID_HEADER string = "X-OCP-Trace-ID"
 	TimeFormat      string = "2006/01/02 15:04:05"
+
+	// OPERATOR_HEADER is the OCP user on behalf of whom the request is sent, see SetRequestActor
+	OPERATOR_HEADER string = "X-OCP-Operator"
+	// DEBUG_UNMASK_HEADER asks to disable masking of the commands and outputs of the request, see UnmaskDebugHandler
+	DEBUG_UNMASK_HEADER string = "X-OCP-Debug-Unmask"
 )
 
 type Authorizer interface {
@@ -143,6 +148,64 @@ func AuthorizeMiddleware(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, http2.BuildResponse(nil, err))
 		return
 	}
+	SetRequestActor(c)
+	c.Next()
+}
+
+// SetRequestActor sets the actor of an authorized request, so that the logs with the contexts built by
+// NewContextWithTraceId, e.g. the ones of shell commands, carry it for auditing. The actor is the user
+// authorized by header Authorization. The operator in header X-OCP-Operator is set by the client and not verified,
+// so it is only logged as the claimed operator.
+func SetRequestActor(c *gin.Context) {
+	if actor := requestActor(c.Request); actor != "" {
+		c.Set(ActorKey, actor)
+	}
+	if operator := c.GetHeader(OPERATOR_HEADER); operator != "" {
+		c.Set(ClaimedOperatorKey, operator)
+	}
+}
+
+func requestActor(req *http.Request) string {
+	authHeaders := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(authHeaders) != 2 {
+		return ""
+	}
+	content := authHeaders[1]
+	if authHeaders[0] == Basic {
+		decoded, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return ""
+		}
+		content = string(decoded)
+	} else if authHeaders[0] != HmacSHA256 {
+		return ""
+	}
+	// username:password or username:signature
+	return strings.SplitN(content, ":", 2)[0]
+}
+
+// UnmaskDebugHandler disables masking of the commands and outputs of a request with header X-OCP-Debug-Unmask: true,
+// so that they can be inspected while debugging an incident. The request must be authenticated explicitly,
+// and each unmasked request is logged for auditing. Other requests are masked as usual.
+func UnmaskDebugHandler(c *gin.Context) {
+	if c.GetHeader(DEBUG_UNMASK_HEADER) != "true" {
+		c.Next()
+		return
+	}
+	ctx := NewContextWithTraceId(c)
+	ctxlog := log.WithContext(ctx)
+	if httpAuthorizer == nil {
+		ctxlog.Warnf("unmask debug request rejected, no authorizer. url: %s, client: %s", c.Request.URL, c.ClientIP())
+		c.Next()
+		return
+	}
+	if err := httpAuthorizer.Authorize(c.Request); err != nil {
+		ctxlog.Warnf("unmask debug request rejected, url: %s, client: %s, err: %s", c.Request.URL, c.ClientIP(), err)
+		c.Next()
+		return
+	}
+	ctxlog.Warnf("unmask debug request accepted, masking disabled. url: %s, client: %s", c.Request.URL, c.ClientIP())
+	c.Set(UnmaskedKey, true)
 	c.Next()
 }
 
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package common
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/oceanbase/obagent/errors"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 1000
+)
+
+// PageRequest is the paging parameters of a list request, pages start from 1.
+type PageRequest struct {
+	Page int `json:"page" form:"page"` // Page number, default 1
+	Size int `json:"size" form:"size"` // Page size, default DefaultPageSize, at most MaxPageSize
+}
+
+// PageResponse is the data payload of a list response of a single page.
+type PageResponse struct {
+	Total int64       `json:"total"` // Total number of items of all pages
+	Page  int         `json:"page"`  // Page number
+	Size  int         `json:"size"`  // Page size
+	Data  interface{} `json:"data"`  // Items of the page
+}
+
+// Validate checks the paging parameters and fills the defaults: a missing page is the first page,
+// a missing size is DefaultPageSize and a size larger than MaxPageSize is clamped to MaxPageSize.
+func (r *PageRequest) Validate() error {
+	if r.Page < 0 {
+		return errors.NewBadRequestError(errors.ErrIllegalArgument.Code, fmt.Sprintf("invalid page %d: should be positive", r.Page))
+	}
+	if r.Size < 0 {
+		return errors.NewBadRequestError(errors.ErrIllegalArgument.Code, fmt.Sprintf("invalid page size %d: should be positive", r.Size))
+	}
+	if r.Page == 0 {
+		r.Page = 1
+	}
+	if r.Size == 0 {
+		r.Size = DefaultPageSize
+	}
+	if r.Size > MaxPageSize {
+		r.Size = MaxPageSize
+	}
+	return nil
+}
+
+// Offset returns the index of the first item of the page.
+func (r PageRequest) Offset() int {
+	return (r.Page - 1) * r.Size
+}
+
+// GetPageRequest parses and validates the paging parameters from the query of the request.
+func GetPageRequest(c *gin.Context) (PageRequest, error) {
+	var req PageRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return req, errors.NewBadRequestError(errors.ErrIllegalArgument.Code, fmt.Sprintf("invalid paging parameters: %s", err))
+	}
+	if err := req.Validate(); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+// SendPagedResponse sends items of the page requested by the query of the request, along with the total number of items.
+func SendPagedResponse(c *gin.Context, total int64, items interface{}, err error) {
+	if err != nil {
+		SendResponse(c, nil, err)
+		return
+	}
+	req, err := GetPageRequest(c)
+	if err != nil {
+		SendResponse(c, nil, err)
+		return
+	}
+	SendResponse(c, PageResponse{
+		Total: total,
+		Page:  req.Page,
+		Size:  req.Size,
+		Data:  items,
+	}, nil)
+}
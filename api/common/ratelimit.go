@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package common
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oceanbase/obagent/errors"
+)
+
+// RateLimitHandler limits the requests handled by the route group it is used by, or by all routes if it is used
+// globally, with a token bucket: up to burst requests are allowed at once, refilled by rate requests per second.
+// Requests exceeding the limit get a 429 response with a Retry-After header. It should be used after PostHandlers.
+func RateLimitHandler(rate float64, burst int) func(*gin.Context) {
+	bucket := newTokenBucket(rate, burst)
+	return func(c *gin.Context) {
+		ok, retryAfter := bucket.take()
+		if ok {
+			c.Next()
+			return
+		}
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		log.WithContext(NewContextWithTraceId(c)).Warnf("API request rate limited: [%v %v, client=%v, retryAfter=%ds]",
+			c.Request.Method, c.Request.URL, c.ClientIP(), seconds)
+		c.Abort()
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		SendResponse(c, nil, errors.Occur(errors.ErrTooManyRequests, time.Duration(seconds)*time.Second))
+	}
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens refilled per second
+	burst  float64 // max tokens
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// take takes a token if there is one, otherwise returns the time until the next token is available.
+func (b *tokenBucket) take() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if b.rate <= 0 {
+		return false, time.Minute
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
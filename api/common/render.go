@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package common
+
+import (
+	"encoding/json"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/lib/http"
+)
+
+const (
+	mimeJSON = "application/json"
+	mimeYAML = "application/yaml"
+)
+
+var yamlMediaTypes = map[string]bool{
+	"application/yaml":   true,
+	"application/x-yaml": true,
+	"text/yaml":          true,
+	"text/x-yaml":        true,
+}
+
+// renderResponse writes the response as YAML if the Accept header prefers YAML to JSON, otherwise as JSON.
+// The YAML document has the same structure and field names as the JSON one.
+func renderResponse(c *gin.Context, resp http.OcpAgentResponse) {
+	if acceptsYAML(c.GetHeader("Accept")) {
+		body, err := marshalYAML(resp)
+		if err == nil {
+			c.Header("Content-Type", mimeYAML+"; charset=utf-8")
+			c.Data(resp.Status, mimeYAML+"; charset=utf-8", body)
+			return
+		}
+		log.WithContext(NewContextWithTraceId(c)).Warnf("marshal response as yaml failed, send json instead, err: %v", err)
+	}
+	c.JSON(resp.Status, resp)
+}
+
+// acceptsYAML returns whether a YAML media type outranks JSON in the Accept header by the q weights,
+// JSON is sent if they rank the same, e.g. for */*.
+func acceptsYAML(accept string) bool {
+	ranges := parseAccept(accept)
+	yamlQuality := 0.0
+	for mediaType := range yamlMediaTypes {
+		if q := quality(ranges, mediaType); q > yamlQuality {
+			yamlQuality = q
+		}
+	}
+	return yamlQuality > quality(ranges, mimeJSON)
+}
+
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses the media ranges of the Accept header, or the codings of Accept-Encoding,
+// with their q weights, 1 if not given. Malformed ranges are skipped.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// quality returns the q weight of mediaType by the most specific range matching it, 0 if none matches.
+// mediaType may also be a content coding, which is matched by itself or "*".
+func quality(ranges []mediaRange, mediaType string) float64 {
+	mainType := strings.SplitN(mediaType, "/", 2)[0]
+	bestSpecificity, q := -1, 0.0
+	for _, r := range ranges {
+		specificity := -1
+		switch r.mediaType {
+		case mediaType:
+			specificity = 2
+		case mainType + "/*":
+			specificity = 1
+		case "*/*", "*":
+			specificity = 0
+		}
+		if specificity > bestSpecificity || (specificity == bestSpecificity && specificity >= 0 && r.q > q) {
+			bestSpecificity, q = specificity, r.q
+		}
+	}
+	return q
+}
+
+// marshalYAML converts the JSON form of v to YAML, so that the field names follow the json tags
+// and the fields keep their order.
+func marshalYAML(v interface{}) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(body, &node); err != nil {
+		return nil, err
+	}
+	resetYAMLStyle(&node)
+	return yaml.Marshal(&node)
+}
+
+// resetYAMLStyle drops the flow style and quotes of JSON, so that the document is in block style.
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package common
+
+import (
+	"encoding/json"
+	nethttp "net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oceanbase/obagent/lib/http"
+)
+
+// streamedResponseKey is set in gin.Context once the response is streamed, so that PostHandlers does not send it again.
+const streamedResponseKey = "streamedResponse"
+
+// StreamWriter writes the items of a streaming response one by one, see SendStreamResponse.
+type StreamWriter struct {
+	c         *gin.Context
+	startedAt time.Time
+	started   bool // whether the header of the envelope is written
+	count     int
+	err       error // error of writing to the client, the stream is broken once it is set
+}
+
+// SendStreamResponse streams the items written by write as the contents of the data of the response, in the same
+// shape as the response of a slice by SendResponse, without buffering the whole payload in memory.
+// Each item is flushed to the client once written, e.g. lines of a command got by shell.Command.ExecuteStream.
+//
+// If write fails before writing any item, the error is sent like SendResponse. Otherwise the status of HTTP is 200
+// as it is sent already, and the error is reported at the end of the body, with successful set to false and
+// the status and error of the envelope set like the error is sent by SendResponse.
+// The response is always sent as JSON, and SendResponse should not be called for the request then.
+func SendStreamResponse(c *gin.Context, write func(w *StreamWriter) error) {
+	w := &StreamWriter{c: c, startedAt: requestStartTime(c, time.Now())}
+	err := write(w)
+	if err == nil {
+		err = w.err
+	}
+	if !w.started {
+		if err != nil {
+			SendResponse(c, nil, err)
+			return
+		}
+		if err = w.start(); err != nil {
+			log.WithContext(NewContextWithTraceId(c)).Warnf("write stream response failed, err: %v", err)
+			return
+		}
+	}
+	w.finish(err)
+}
+
+// Write sends the item to the client. It fails if the item can not be marshalled or the client is gone,
+// the stream is broken then and the writer should stop.
+func (w *StreamWriter) Write(item interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	body, err := json.Marshal(item)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	if !w.started {
+		if err = w.start(); err != nil {
+			w.err = err
+			return err
+		}
+	}
+	if w.count > 0 {
+		body = append([]byte{','}, body...)
+	}
+	if _, err = w.c.Writer.Write(body); err != nil {
+		w.err = err
+		return err
+	}
+	w.count++
+	w.c.Writer.Flush()
+	return nil
+}
+
+// Count returns the number of items written.
+func (w *StreamWriter) Count() int {
+	return w.count
+}
+
+// start writes the header of the envelope till the beginning of the contents.
+// The fields depending on the result are written by finish, after the contents.
+func (w *StreamWriter) start() error {
+	w.started = true
+	w.c.Set(streamedResponseKey, true)
+	server, _ := libSystem.GetLocalIpAddress()
+	header, err := json.Marshal(struct {
+		Timestamp time.Time `json:"timestamp"`
+		TraceId   string    `json:"traceId"`
+		Server    string    `json:"server"`
+	}{w.startedAt, w.c.GetString(TraceIdKey), server})
+	if err != nil {
+		return err
+	}
+	w.c.Header("Content-Type", mimeJSON+"; charset=utf-8")
+	w.c.Status(nethttp.StatusOK)
+	// open the envelope and its data, leaving out the closing brace of the header
+	header = append(header[:len(header)-1], []byte(`,"data":{"contents":[`)...)
+	_, err = w.c.Writer.Write(header)
+	return err
+}
+
+// finish closes the contents and writes the result of the stream, which is also kept for PostHandlers to log.
+func (w *StreamWriter) finish(err error) {
+	resp := http.BuildResponse(nil, err)
+	resp.Duration = int(time.Since(w.startedAt) / time.Millisecond)
+	resp.ServerTimestamp = time.Now()
+	w.c.Set(OcpAgentResponseKey, resp)
+	trailer, marshalErr := json.Marshal(struct {
+		Successful      bool           `json:"successful"`
+		Duration        int            `json:"duration"`
+		Status          int            `json:"status"`
+		Error           *http.ApiError `json:"error,omitempty"`
+		ServerTimestamp time.Time      `json:"serverTimestamp"`
+	}{resp.Successful, resp.Duration, resp.Status, resp.Error, resp.ServerTimestamp})
+	if marshalErr != nil {
+		trailer = []byte(`{"successful":false}`)
+	}
+	// the trailer continues the envelope, replacing its opening brace
+	trailer = append([]byte("]},"), trailer[1:]...)
+	if _, writeErr := w.c.Writer.Write(trailer); writeErr != nil {
+		log.WithContext(NewContextWithTraceId(w.c)).Warnf("write stream response failed, err: %v", writeErr)
+		return
+	}
+	w.c.Writer.Flush()
+}
@@ -29,45 +29,54 @@ func InitManagerAgentRoutes(s *http.StateHolder, r *gin.Engine) {
 	r.GET("/metrics/stat", adapter.Wrap(stat.PromHandler))
 	r.Use(
 		gin.CustomRecovery(common.Recovery), // gin's crash-free middleware
+		common.BodyLimitHandler(common.DefaultMaxRequestBodyBytes),
 		common.PreHandlers("/api/v1/module/config/update", "/api/v1/module/config/validate"),
+		common.UnmaskDebugHandler,
+		common.GzipHandler(common.DefaultGzipThreshold),
 		common.SetContentType,
 		common.PostHandlers("/debug/pprof"),
+		common.RecoveryHandler,
 	)
 
 	v1 := r.Group("/api/v1")
-	v1.GET("/time", common.TimeHandler)
-	v1.GET("/info", common.InfoHandler)
-	v1.GET("/git-info", common.GitInfoHandler)
-	v1.GET("/status", common.StatusHandler(s))
-	v1.POST("/status", common.StatusHandler(s))
+	// synchronous routes are limited by the request timeout,
+	// async tasks and log routes are limited by their own
+	syncV1 := v1.Group("", common.TimeoutHandler(common.DefaultRequestTimeout))
+	syncV1.GET("/time", common.TimeHandler)
+	syncV1.GET("/info", common.InfoHandler)
+	syncV1.GET("/git-info", common.GitInfoHandler)
+	syncV1.GET("/status", common.StatusHandler(s))
+	syncV1.POST("/status", common.StatusHandler(s))
+	syncV1.GET("/health", common.HealthHandler)
+	syncV1.GET("/debug/commands", common.ActiveCommandsHandler)
 
 	// task routes
-	task := v1.Group("/task")
+	task := syncV1.Group("/task")
 	task.POST("/status", queryTaskHandler)
 	task.GET("/status", queryTaskHandler)
 
 	// agent admin routes
-	agent := v1.Group("/agent")
+	agent := syncV1.Group("/agent")
 	agent.POST("/status", agentStatusService)
 	agent.GET("/status", agentStatusService)
-	agent.POST("/restart", asyncCommandHandler(restartCmd))
+	v1.POST("/agent/restart", asyncCommandHandler(restartCmd))
 
 	// file routes
-	file := v1.Group("/file")
+	file := syncV1.Group("/file")
 	file.POST("/exists", isFileExists)
 	file.POST("/getRealPath", getRealStaticPath)
 
 	// system routes
-	system := v1.Group("/system")
+	system := syncV1.Group("/system")
 	system.POST("/hostInfo", getHostInfoHandler)
 
 	// module config
-	v1.POST("/module/config/update", common.UpdateConfigPropertiesHandler)
-	v1.POST("/module/config/notify", common.NotifyConfigPropertiesHandler)
-	v1.POST("/module/config/validate", common.ValidateConfigPropertiesHandler)
-	v1.GET("/module/config/status", common.ConfigStatusHandler)
-	v1.POST("/module/config/change", common.ChangeConfigHandler)
-	v1.POST("/module/config/reload", common.ReloadConfigHandler)
+	syncV1.POST("/module/config/update", common.UpdateConfigPropertiesHandler)
+	syncV1.POST("/module/config/notify", common.NotifyConfigPropertiesHandler)
+	syncV1.POST("/module/config/validate", common.ValidateConfigPropertiesHandler)
+	syncV1.GET("/module/config/status", common.ConfigStatusHandler)
+	syncV1.POST("/module/config/change", common.ChangeConfigHandler)
+	syncV1.POST("/module/config/reload", common.ReloadConfigHandler)
 
 	logGroup := v1.Group("/log")
 	logGroup.POST("/query", queryLogHandler)
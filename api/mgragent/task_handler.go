@@ -66,7 +66,8 @@ func TaskCount() int {
 
 func asyncCommandHandler(task command.Command) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx := common.NewContextWithTraceId(c)
+		// the task keeps running after the response is sent
+		ctx := common.NewTaskContextWithTraceId(c)
 		defaultParam := task.DefaultParam()
 		v := reflect.New(reflect.TypeOf(defaultParam))
 		v.Elem().Set(reflect.ValueOf(defaultParam))
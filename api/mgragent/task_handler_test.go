@@ -103,3 +103,33 @@ func TestAsyncCommandHandler2(t *testing.T) {
 		t.Errorf("bad result %+v", s)
 	}
 }
+
+func TestAsyncCommandHandlerNotLimitedByRequest(t *testing.T) {
+	os.MkdirAll(path2.TaskStoreDir(), 0755)
+	defer os.RemoveAll(path2.TaskStoreDir())
+
+	h := asyncCommandHandler(command.WrapFunc(func(ctx context.Context, s S) (S, error) {
+		return s, ctx.Err()
+	}))
+	req, _ := http.NewRequest("POST", "/xxx", strings.NewReader(`{"A":"a", "taskToken":"token12346"}`))
+	rec := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(rec)
+	ctx.Request = req
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx.Keys = map[string]interface{}{common.TraceIdKey: "a", common.RequestContextKey: reqCtx}
+	h(ctx)
+	resp := ctx.Keys[common.OcpAgentResponseKey].(http2.OcpAgentResponse)
+	if !resp.Successful {
+		t.Errorf("Fail %+v", resp)
+		return
+	}
+	result, ok := taskExecutor.WaitResult(command.ExecutionTokenFromString("token12346"))
+	if !ok {
+		t.Error("wait result failed")
+		return
+	}
+	if !result.Ok {
+		t.Errorf("task cancelled with the request: %s", result.Err)
+	}
+}
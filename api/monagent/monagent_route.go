@@ -32,7 +32,7 @@ func InitMonitorAgentRoutes(router *gin.Engine, localRouter *gin.Engine) {
 	router.GET("/metrics/stat", adapter.Wrap(stat.PromHandler))
 
 	v1 := router.Group("/api/v1")
-	v1.Use(common.PostHandlers())
+	v1.Use(common.PostHandlers(), common.RecoveryHandler, common.TimeoutHandler(common.DefaultRequestTimeout))
 
 	v1.POST("/module/config/update", common.UpdateConfigPropertiesHandler)
 	v1.POST("/module/config/notify", common.NotifyConfigPropertiesHandler)
@@ -43,6 +43,7 @@ func InitMonitorAgentRoutes(router *gin.Engine, localRouter *gin.Engine) {
 	v1.GET("/git-info", common.GitInfoHandler)
 	v1.POST("/status", monitorStatusHandler)
 	v1.GET("/status", monitorStatusHandler)
+	v1.GET("/health", common.HealthHandler)
 
 	initMonagentLocalRoutes(localRouter)
 }
@@ -53,12 +54,14 @@ func initMonagentLocalRoutes(localRouter *gin.Engine) {
 	localRouter.GET("/metrics/stat", adapter.Wrap(stat.PromHandler))
 
 	group := localRouter.Group("/api/v1")
+	group.Use(common.TimeoutHandler(common.DefaultRequestTimeout))
 	group.GET("/time", common.TimeHandler)
 	group.GET("/info", common.InfoHandler)
 	group.POST("/info", common.InfoHandler)
 	group.GET("/git-info", common.GitInfoHandler)
 	group.POST("/status", monitorStatusHandler)
 	group.GET("/status", monitorStatusHandler)
+	group.GET("/health", common.HealthHandler)
 	group.POST("/module/config/update", common.UpdateConfigPropertiesHandler)
 	group.POST("/module/config/notify", common.NotifyConfigPropertiesHandler)
 }
@@ -67,8 +70,10 @@ func UseLocalMonitorMiddleware(r *gin.Engine) {
 	r.Use(
 		common.HttpStatMiddleware,
 		gin.CustomRecovery(common.Recovery), // gin's crash-free middleware
+		common.BodyLimitHandler(common.DefaultMaxRequestBodyBytes),
 		common.PreHandlers("/api/v1/module/config/update", "/api/v1/module/config/validate"),
 		common.PostHandlers("/debug/pprof", "/debug/fgprof", "/metrics/", "/api/v1/log/alarms"),
+		common.RecoveryHandler,
 	)
 }
 
@@ -76,6 +81,7 @@ func UseMonitorMiddleware(r *gin.Engine) {
 	r.Use(
 		common.HttpStatMiddleware,
 		gin.CustomRecovery(common.Recovery), // gin's crash-free middleware
+		common.BodyLimitHandler(common.DefaultMaxRequestBodyBytes),
 		common.PreHandlers("/api/v1/module/config/update", "/api/v1/module/config/validate"),
 		common.MonitorAgentPostHandler,
 	)
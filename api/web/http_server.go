@@ -64,6 +64,7 @@ func (server *HttpServer) AuthorizeMiddleware(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, http2.BuildResponse(nil, err))
 		return
 	}
+	common.SetRequestActor(c)
 	c.Next()
 }
 
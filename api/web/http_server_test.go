@@ -14,6 +14,7 @@ package web
 
 import (
 	"context"
+	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -21,6 +22,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/oceanbase/obagent/api/common"
+	"github.com/oceanbase/obagent/config"
+	agentlog "github.com/oceanbase/obagent/log"
 )
 
 func TestCounter(t *testing.T) {
@@ -91,3 +96,47 @@ func TestHttpServer(t *testing.T) {
 func fooHandler(c *gin.Context) {
 	time.Sleep(time.Second)
 }
+
+type acceptAllAuthorizer struct{}
+
+func (a acceptAllAuthorizer) Authorize(req *http.Request) error {
+	return nil
+}
+
+func (a acceptAllAuthorizer) SetConf(conf config.BasicAuthConfig) {
+}
+
+func TestHttpServerActor(t *testing.T) {
+	server := &HttpServer{
+		Router:          gin.New(),
+		BasicAuthorizer: acceptAllAuthorizer{},
+	}
+	server.UseBasicAuth()
+	var actor, operator interface{}
+	server.Router.GET("/foo", func(c *gin.Context) {
+		ctx := common.NewContextWithTraceId(c)
+		actor, operator = ctx.Value(agentlog.ActorKey{}), ctx.Value(agentlog.ClaimedOperatorKey{})
+	})
+	get := func(headers ...string) interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		server.Router.ServeHTTP(httptest.NewRecorder(), req)
+		return actor
+	}
+
+	Convey("actor of basic auth", t, func() {
+		So(get("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("ocp:pass"))), ShouldEqual, "ocp")
+	})
+	Convey("actor of digest auth", t, func() {
+		So(get("Authorization", "OCP-HMACSHA256 ocp:sign"), ShouldEqual, "ocp")
+	})
+	Convey("operator header is not the actor", t, func() {
+		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("ocp:pass"))
+		So(get("Authorization", auth, common.OPERATOR_HEADER, "admin"), ShouldEqual, "ocp")
+		So(operator, ShouldEqual, "admin")
+		So(get(common.OPERATOR_HEADER, "admin"), ShouldBeNil)
+		So(operator, ShouldEqual, "admin")
+	})
+}
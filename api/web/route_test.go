@@ -13,20 +13,32 @@
 package web
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v3"
 
 	"github.com/oceanbase/obagent/api/common"
 	"github.com/oceanbase/obagent/config"
 	"github.com/oceanbase/obagent/config/mgragent"
 	"github.com/oceanbase/obagent/errors"
 	http2 "github.com/oceanbase/obagent/lib/http"
+	"github.com/oceanbase/obagent/lib/shell"
+	"github.com/oceanbase/obagent/lib/trace"
+	agentlog "github.com/oceanbase/obagent/log"
 )
 
 func Test_RouteHandler(t *testing.T) {
@@ -82,6 +94,16 @@ func Test_RouteHandler(t *testing.T) {
 				statusCode: http.StatusBadRequest,
 			},
 		},
+		{
+			name: "example5",
+			args: args{
+				url: "http://127.0.0.1:62888/api/example/5",
+			},
+			want: want{
+				successful: false,
+				statusCode: http.StatusInternalServerError,
+			},
+		},
 	}
 	server := NewServer(config.AgentVersion, mgragent.ServerConfig{})
 	InitExampleRoutes(server.Router)
@@ -107,6 +129,504 @@ func Test_RouteHandler(t *testing.T) {
 	}
 }
 
+func Test_RouteTraceId(t *testing.T) {
+	server := NewServer(config.AgentVersion, mgragent.ServerConfig{})
+	InitExampleRoutes(server.Router)
+	Convey("generate traceId if not passed", t, func() {
+		req := httptest.NewRequest("GET", "http://127.0.0.1:62888/api/example/1", nil)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+
+		var resp http2.OcpAgentResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		traceId := w.Header().Get(trace.TraceIdHeader)
+		So(traceId, ShouldNotBeEmpty)
+		So(resp.TraceId, ShouldEqual, traceId)
+	})
+	Convey("echo traceId passed", t, func() {
+		req := httptest.NewRequest("GET", "http://127.0.0.1:62888/api/example/1", nil)
+		req.Header.Set(trace.TraceIdHeader, "abcdefg")
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+
+		var resp http2.OcpAgentResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		So(w.Header().Get(trace.TraceIdHeader), ShouldEqual, "abcdefg")
+		So(resp.TraceId, ShouldEqual, "abcdefg")
+	})
+	Convey("keep traceId on panic", t, func() {
+		req := httptest.NewRequest("GET", "http://127.0.0.1:62888/api/example/5", nil)
+		req.Header.Set(trace.TraceIdHeader, "abcdefg")
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+
+		var resp http2.OcpAgentResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		So(resp.TraceId, ShouldEqual, "abcdefg")
+		So(resp.Error.Code, ShouldEqual, errors.ErrUnexpected.Code)
+	})
+}
+
+func Test_RoutePagination(t *testing.T) {
+	server := NewServer(config.AgentVersion, mgragent.ServerConfig{})
+	InitExampleRoutes(server.Router)
+	get := func(query string) (int, http2.OcpAgentResponse) {
+		req := httptest.NewRequest("GET", "http://127.0.0.1:62888/api/example/6"+query, nil)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		resp := http2.OcpAgentResponse{Data: &common.PageResponse{}}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+	Convey("default page", t, func() {
+		code, resp := get("")
+		So(code, ShouldEqual, http.StatusOK)
+		page := resp.Data.(*common.PageResponse)
+		So(page.Total, ShouldEqual, 5)
+		So(page.Page, ShouldEqual, 1)
+		So(page.Size, ShouldEqual, common.DefaultPageSize)
+		So(page.Data, ShouldHaveLength, 5)
+	})
+	Convey("second page", t, func() {
+		_, resp := get("?page=2&size=2")
+		page := resp.Data.(*common.PageResponse)
+		So(page.Page, ShouldEqual, 2)
+		So(page.Data, ShouldResemble, []interface{}{float64(3), float64(4)})
+	})
+	Convey("size is clamped", t, func() {
+		_, resp := get("?size=100000")
+		So(resp.Data.(*common.PageResponse).Size, ShouldEqual, common.MaxPageSize)
+	})
+	Convey("invalid page", t, func() {
+		code, resp := get("?page=-1")
+		So(code, ShouldEqual, http.StatusBadRequest)
+		So(resp.Error.Code, ShouldEqual, errors.ErrIllegalArgument.Code)
+
+		code, _ = get("?size=abc")
+		So(code, ShouldEqual, http.StatusBadRequest)
+	})
+}
+
+func Test_RouteTimeout(t *testing.T) {
+	server := NewServer(config.AgentVersion, mgragent.ServerConfig{})
+	InitExampleRoutes(server.Router)
+	Convey("slow command is cancelled on request timeout", t, func() {
+		start := time.Now()
+		req := httptest.NewRequest("GET", "http://127.0.0.1:62888/api/example/timeout/1", nil)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+
+		var resp http2.OcpAgentResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+		So(resp.Error.Code, ShouldEqual, errors.ErrRequestTimeout.Code)
+		So(time.Since(start), ShouldBeLessThan, 4*time.Second)
+	})
+}
+
+func Test_RouteShellDefaults(t *testing.T) {
+	server := NewServer(config.AgentVersion, mgragent.ServerConfig{})
+	InitExampleRoutes(server.Router)
+	Convey("commands of the request run with the default timeout", t, func() {
+		start := time.Now()
+		req := httptest.NewRequest("GET", "http://127.0.0.1:62888/api/example/defaults/1", nil)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+
+		var resp http2.OcpAgentResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		So(resp.Successful, ShouldBeFalse)
+		So(resp.Error.Message, ShouldContainSubstring, "timed out after 1s")
+		So(time.Since(start), ShouldBeLessThan, 4*time.Second)
+	})
+}
+
+func Test_RouteGzip(t *testing.T) {
+	server := NewServer(config.AgentVersion, mgragent.ServerConfig{})
+	InitExampleRoutes(server.Router)
+	getEncoded := func(url string, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+	get := func(url string) *httptest.ResponseRecorder {
+		return getEncoded(url, "gzip")
+	}
+	Convey("large response is compressed", t, func() {
+		w := get("http://127.0.0.1:62888/api/example/7")
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+		reader, err := gzip.NewReader(w.Body)
+		So(err, ShouldBeNil)
+		body, err := ioutil.ReadAll(reader)
+		So(err, ShouldBeNil)
+
+		var resp http2.OcpAgentResponse
+		So(json.Unmarshal(body, &resp), ShouldBeNil)
+		So(resp.Successful, ShouldBeTrue)
+		So(resp.Data, ShouldEqual, strings.Repeat("a", 10*common.DefaultGzipThreshold))
+	})
+	Convey("q weights of Accept-Encoding", t, func() {
+		url := "http://127.0.0.1:62888/api/example/7"
+		So(getEncoded(url, "deflate, gzip;q=0.5").Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+		So(getEncoded(url, "*").Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+		So(getEncoded(url, "gzip;q=0, deflate").Header().Get("Content-Encoding"), ShouldBeEmpty)
+		So(getEncoded(url, "*;q=0").Header().Get("Content-Encoding"), ShouldBeEmpty)
+		So(getEncoded(url, "gzip;q=0, *").Header().Get("Content-Encoding"), ShouldBeEmpty)
+	})
+	Convey("small response is not compressed", t, func() {
+		w := get("http://127.0.0.1:62888/api/example/1")
+		So(w.Header().Get("Content-Encoding"), ShouldBeEmpty)
+		var resp http2.OcpAgentResponse
+		So(json.Unmarshal(w.Body.Bytes(), &resp), ShouldBeNil)
+		So(resp.Data, ShouldEqual, "this is data")
+	})
+	Convey("compressed response is not compressed again", t, func() {
+		router := gin.New()
+		router.Use(common.GzipHandler(0))
+		router.GET("/file.gz", func(c *gin.Context) {
+			c.Data(http.StatusOK, "application/gzip", []byte("compressed"))
+		})
+		req := httptest.NewRequest("GET", "http://127.0.0.1:62888/file.gz", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		So(w.Header().Get("Content-Encoding"), ShouldBeEmpty)
+		So(w.Body.String(), ShouldEqual, "compressed")
+	})
+}
+
+func Test_RouteRateLimit(t *testing.T) {
+	server := NewServer(config.AgentVersion, mgragent.ServerConfig{})
+	InitExampleRoutes(server.Router)
+	Convey("requests exceeding burst are rejected", t, func() {
+		var codes []int
+		var w *httptest.ResponseRecorder
+		for i := 0; i < 3; i++ {
+			req := httptest.NewRequest("GET", "http://127.0.0.1:62888/api/example/limited/1", nil)
+			w = httptest.NewRecorder()
+			server.Router.ServeHTTP(w, req)
+			codes = append(codes, w.Code)
+		}
+		So(codes, ShouldResemble, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests})
+		So(w.Header().Get("Retry-After"), ShouldEqual, "2")
+		var resp http2.OcpAgentResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		So(resp.Error.Code, ShouldEqual, errors.ErrTooManyRequests.Code)
+	})
+}
+
+func Test_RouteBindError(t *testing.T) {
+	server := NewServer(config.AgentVersion, mgragent.ServerConfig{})
+	InitExampleRoutes(server.Router)
+	post := func(body string) (int, http2.OcpAgentResponse) {
+		req := httptest.NewRequest("POST", "http://127.0.0.1:62888/api/example/8", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		var resp http2.OcpAgentResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+	Convey("validation errors of each field", t, func() {
+		code, resp := post(`{"count": 0}`)
+		So(code, ShouldEqual, http.StatusBadRequest)
+		So(resp.Error.Code, ShouldEqual, errors.ErrBadRequest.Code)
+		So(resp.Error.SubErrors, ShouldHaveLength, 2)
+		fieldError := resp.Error.SubErrors[0].(map[string]interface{})
+		So(fieldError["field"], ShouldEqual, "Name")
+		So(fieldError["tag"], ShouldEqual, "required")
+		So(fieldError["key"], ShouldEqual, "err.validation.required")
+		So(fieldError["message"], ShouldEqual, "Name is required")
+		fieldError = resp.Error.SubErrors[1].(map[string]interface{})
+		So(fieldError["key"], ShouldEqual, "err.validation.min")
+		So(fieldError["message"], ShouldEqual, "Count must be at least 1")
+	})
+	Convey("malformed request", t, func() {
+		code, resp := post(`{`)
+		So(code, ShouldEqual, http.StatusBadRequest)
+		So(resp.Error.Code, ShouldEqual, errors.ErrBadRequest.Code)
+	})
+	Convey("valid request", t, func() {
+		code, resp := post(`{"name": "a", "count": 1}`)
+		So(code, ShouldEqual, http.StatusOK)
+		So(resp.Data, ShouldEqual, "a")
+	})
+}
+
+func Test_RouteResponseWithStatus(t *testing.T) {
+	server := NewServer(config.AgentVersion, mgragent.ServerConfig{})
+	InitExampleRoutes(server.Router)
+	Convey("response with status", t, func() {
+		req := httptest.NewRequest("POST", "http://127.0.0.1:62888/api/example/9", nil)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		var resp http2.OcpAgentResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		So(w.Code, ShouldEqual, http.StatusCreated)
+		So(resp.Status, ShouldEqual, http.StatusCreated)
+		So(resp.Successful, ShouldBeTrue)
+		So(resp.Data, ShouldEqual, "created")
+	})
+	Convey("failed request keeps the status of its error", t, func() {
+		req := httptest.NewRequest("POST", "http://127.0.0.1:62888/api/example/10", nil)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		var resp http2.OcpAgentResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(resp.Status, ShouldEqual, http.StatusBadRequest)
+		So(resp.Successful, ShouldBeFalse)
+	})
+}
+
+func Test_RouteYAML(t *testing.T) {
+	server := NewServer(config.AgentVersion, mgragent.ServerConfig{})
+	InitExampleRoutes(server.Router)
+	get := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://127.0.0.1:62888/api/example/4", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		return w
+	}
+	Convey("yaml response has the same structure as json", t, func() {
+		w := get("application/yaml")
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Header().Get("Content-Type"), ShouldStartWith, "application/yaml")
+		var fromYAML map[string]interface{}
+		So(yaml.Unmarshal(w.Body.Bytes(), &fromYAML), ShouldBeNil)
+
+		w = get("application/json")
+		So(w.Header().Get("Content-Type"), ShouldStartWith, "application/json")
+		var fromJSON map[string]interface{}
+		So(json.Unmarshal(w.Body.Bytes(), &fromJSON), ShouldBeNil)
+
+		So(fromYAML["successful"], ShouldEqual, false)
+		So(fromYAML["traceId"], ShouldNotBeEmpty)
+		So(fromYAML["error"].(map[string]interface{})["code"], ShouldEqual, fromJSON["error"].(map[string]interface{})["code"])
+		So(len(fromYAML), ShouldEqual, len(fromJSON))
+	})
+	Convey("json is the default", t, func() {
+		So(get("*/*").Header().Get("Content-Type"), ShouldStartWith, "application/json")
+		So(get("application/json, application/yaml").Header().Get("Content-Type"), ShouldStartWith, "application/json")
+	})
+	Convey("q weights of the media ranges", t, func() {
+		So(get("application/json, application/yaml;q=0.1").Header().Get("Content-Type"), ShouldStartWith, "application/json")
+		So(get("application/json;q=0.5, application/yaml").Header().Get("Content-Type"), ShouldStartWith, "application/yaml")
+		So(get("application/yaml;q=0").Header().Get("Content-Type"), ShouldStartWith, "application/json")
+		So(get("text/yaml, */*;q=0.1").Header().Get("Content-Type"), ShouldStartWith, "application/yaml")
+		So(get("application/*;q=0.2, application/yaml;q=0.1").Header().Get("Content-Type"), ShouldStartWith, "application/json")
+	})
+}
+
+func Test_RouteDuration(t *testing.T) {
+	router := gin.New()
+	slow := func(c *gin.Context) {
+		time.Sleep(50 * time.Millisecond)
+		c.Next()
+	}
+	// the time of slow middlewares before PostHandlers counts too
+	router.Use(common.PreHandlers(), slow, common.PostHandlers())
+	router.GET("/1", exampleHandler1)
+	Convey("duration and server timestamp", t, func() {
+		before := time.Now()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "http://127.0.0.1:62888/1", nil))
+		var resp http2.OcpAgentResponse
+		So(json.Unmarshal(w.Body.Bytes(), &resp), ShouldBeNil)
+		So(resp.Duration, ShouldBeGreaterThanOrEqualTo, 50)
+		So(resp.ServerTimestamp, ShouldHappenOnOrBetween, before, time.Now())
+		So(resp.ServerTimestamp, ShouldHappenOnOrAfter, resp.Timestamp)
+	})
+}
+
+func Test_RouteActiveCommands(t *testing.T) {
+	router := gin.New()
+	router.Use(common.PreHandlers(), common.PostHandlers())
+	router.GET("/commands", common.ActiveCommandsHandler)
+	Convey("active commands", t, func() {
+		p, err := shell.ShellImpl{}.NewCommand("sleep 0.3").Start()
+		So(err, ShouldBeNil)
+		defer p.Kill()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "http://127.0.0.1:62888/commands", nil))
+		var commands []shell.CommandInfo
+		resp := http2.OcpAgentResponse{Data: &http2.IterableData{Contents: &commands}}
+		So(json.Unmarshal(w.Body.Bytes(), &resp), ShouldBeNil)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		pids := make([]int, 0, len(commands))
+		for _, command := range commands {
+			pids = append(pids, command.Pid)
+		}
+		So(pids, ShouldContain, p.Pid())
+	})
+}
+
+func Test_RouteAccessLog(t *testing.T) {
+	router := gin.New()
+	router.Use(common.PreHandlers(), common.PostHandlers("/excluded"))
+	router.GET("/api/:id", func(c *gin.Context) {
+		common.SendResponse(c, nil, errors.Occur(errors.ErrBadRequest, "bad id"))
+	})
+	router.GET("/excluded", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	hook := new(test.Hook)
+	hooks := logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+	defer logrus.StandardLogger().ReplaceHooks(hooks)
+	logrus.AddHook(hook)
+	accessLog := func(path string) *logrus.Entry {
+		var entry *logrus.Entry
+		for _, e := range hook.AllEntries() {
+			if e.Data["path"] == path {
+				So(entry, ShouldBeNil)
+				entry = e
+			}
+		}
+		return entry
+	}
+	Convey("access log", t, func() {
+		for _, path := range []string{"/api/4", "/excluded"} {
+			hook.Reset()
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set(trace.TraceIdHeader, "abcdefg")
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			entry := accessLog(path)
+			So(entry, ShouldNotBeNil)
+			So(entry.Level, ShouldEqual, logrus.InfoLevel)
+			So(entry.Data["method"], ShouldEqual, "GET")
+			So(entry.Data["latency"], ShouldNotBeNil)
+			So(entry.Context.Value(agentlog.TraceIdKey{}), ShouldEqual, "abcdefg")
+			if path == "/excluded" {
+				So(entry.Data["status"], ShouldEqual, http.StatusOK)
+			} else {
+				So(entry.Data["status"], ShouldEqual, http.StatusBadRequest)
+			}
+		}
+	})
+}
+
+func Test_RouteStreamResponse(t *testing.T) {
+	router := gin.New()
+	router.Use(common.PreHandlers(), common.GzipHandler(common.DefaultGzipThreshold), common.PostHandlers())
+	router.GET("/stream", func(c *gin.Context) {
+		failAt := c.Query("failAt")
+		common.SendStreamResponse(c, func(w *common.StreamWriter) error {
+			for i := 0; i < 3; i++ {
+				if failAt == strconv.Itoa(i) {
+					return errors.Occur(errors.ErrBadRequest, "fail at "+failAt)
+				}
+				if err := w.Write(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	get := func(url string) (int, http2.OcpAgentResponse, []int) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		var items []int
+		resp := http2.OcpAgentResponse{Data: &http2.IterableData{Contents: &items}}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp, items
+	}
+	Convey("all items are streamed", t, func() {
+		code, resp, items := get("http://127.0.0.1:62888/stream")
+		So(code, ShouldEqual, http.StatusOK)
+		So(resp.Successful, ShouldBeTrue)
+		So(resp.Status, ShouldEqual, http.StatusOK)
+		So(items, ShouldResemble, []int{0, 1, 2})
+		So(resp.ServerTimestamp.IsZero(), ShouldBeFalse)
+	})
+	Convey("error in the middle of the stream", t, func() {
+		code, resp, items := get("http://127.0.0.1:62888/stream?failAt=2")
+		So(code, ShouldEqual, http.StatusOK)
+		So(resp.Successful, ShouldBeFalse)
+		So(resp.Status, ShouldEqual, http.StatusBadRequest)
+		So(resp.Error.Code, ShouldEqual, errors.ErrBadRequest.Code)
+		So(items, ShouldResemble, []int{0, 1})
+	})
+	Convey("error before any item", t, func() {
+		code, resp, _ := get("http://127.0.0.1:62888/stream?failAt=0")
+		So(code, ShouldEqual, http.StatusBadRequest)
+		So(resp.Successful, ShouldBeFalse)
+	})
+}
+
+func Test_RouteBodyLimit(t *testing.T) {
+	router := gin.New()
+	router.Use(common.BodyLimitHandler(32), common.PreHandlers(), common.PostHandlers())
+	router.POST("/echo", exampleHandler8)
+	post := func(body string, chunked bool) (int, http2.OcpAgentResponse) {
+		req := httptest.NewRequest("POST", "http://127.0.0.1:62888/echo", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp http2.OcpAgentResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+	Convey("small body", t, func() {
+		code, _ := post(`{"name":"a","count":1}`, false)
+		So(code, ShouldEqual, http.StatusOK)
+	})
+	Convey("large body", t, func() {
+		code, resp := post(`{"name":"`+strings.Repeat("a", 100)+`"}`, false)
+		So(code, ShouldEqual, http.StatusRequestEntityTooLarge)
+		So(resp.Error.Code, ShouldEqual, errors.ErrRequestTooLarge.Code)
+
+		code, resp = post(`{"name":"`+strings.Repeat("a", 100)+`"}`, true)
+		So(code, ShouldEqual, http.StatusRequestEntityTooLarge)
+		So(resp.Error.Code, ShouldEqual, errors.ErrRequestTooLarge.Code)
+		So(resp.TraceId, ShouldNotBeEmpty)
+	})
+	Convey("body failed to read below the limit", t, func() {
+		body := io.MultiReader(strings.NewReader(`{"name"`), iotest.ErrReader(io.ErrUnexpectedEOF))
+		req := httptest.NewRequest("POST", "http://127.0.0.1:62888/echo", body)
+		req.Header.Set("Content-Type", "application/json")
+		req.ContentLength = -1
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp http2.OcpAgentResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(resp.Error.Code, ShouldNotEqual, errors.ErrRequestTooLarge.Code)
+	})
+}
+
+func Test_RouteHealth(t *testing.T) {
+	server := NewServer(config.AgentVersion, mgragent.ServerConfig{})
+	get := func(url string) (int, http2.Health) {
+		req := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		server.Router.ServeHTTP(w, req)
+		health := http2.Health{}
+		resp := http2.OcpAgentResponse{Data: &health}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, health
+	}
+	Convey("liveness", t, func() {
+		code, health := get("http://127.0.0.1:62888/api/v1/health")
+		So(code, ShouldEqual, http.StatusOK)
+		So(health.Version, ShouldEqual, config.AgentVersion)
+		So(health.Exec, ShouldBeFalse)
+	})
+	Convey("deep check", t, func() {
+		code, health := get("http://127.0.0.1:62888/api/v1/health?deep=true")
+		So(code, ShouldEqual, http.StatusOK)
+		So(health.Exec, ShouldBeTrue)
+	})
+}
+
 // only for test
 func InitExampleRoutes(r *gin.Engine) {
 	v1 := r.Group("/api/example")
@@ -115,6 +635,24 @@ func InitExampleRoutes(r *gin.Engine) {
 	v1.GET("/2", exampleHandler2)
 	v1.GET("/3", exampleHandler3)
 	v1.GET("/4", exampleHandler4)
+	v1.GET("/5", exampleHandler5)
+	v1.GET("/6", exampleHandler6)
+	v1.GET("/7", exampleHandler7)
+	v1.POST("/8", exampleHandler8)
+	v1.POST("/9", exampleHandler9)
+	v1.POST("/10", exampleHandler10)
+
+	timeout := r.Group("/api/example/timeout")
+	timeout.Use(common.TimeoutHandler(100 * time.Millisecond))
+	timeout.GET("/1", exampleTimeoutHandler)
+
+	defaults := r.Group("/api/example/defaults")
+	defaults.Use(common.ShellDefaultsHandler(shell.ExecuteDefaults{Timeout: time.Second}))
+	defaults.GET("/1", exampleTimeoutHandler)
+
+	limited := r.Group("/api/example/limited")
+	limited.Use(common.RateLimitHandler(0.5, 2))
+	limited.GET("/1", exampleHandler1)
 }
 
 var exampleHandler1 = func(c *gin.Context) {
@@ -137,6 +675,59 @@ var exampleHandler4 = func(c *gin.Context) {
 	sendResponse(c, data, err)
 }
 
+var exampleHandler5 = func(c *gin.Context) {
+	panic("example panic")
+}
+
+var exampleHandler6 = func(c *gin.Context) {
+	items := []int{1, 2, 3, 4, 5}
+	req, err := common.GetPageRequest(c)
+	if err != nil {
+		common.SendPagedResponse(c, 0, nil, err)
+		return
+	}
+	start, end := req.Offset(), req.Offset()+req.Size
+	if start > len(items) {
+		start = len(items)
+	}
+	if end > len(items) {
+		end = len(items)
+	}
+	common.SendPagedResponse(c, int64(len(items)), items[start:end], nil)
+}
+
+var exampleHandler7 = func(c *gin.Context) {
+	sendResponse(c, strings.Repeat("a", 10*common.DefaultGzipThreshold), nil)
+}
+
+type exampleParam struct {
+	Name  string `json:"name" binding:"required"`
+	Count int    `json:"count" binding:"min=1"`
+}
+
+var exampleHandler8 = func(c *gin.Context) {
+	var param exampleParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		common.SendBindError(c, err)
+		return
+	}
+	sendResponse(c, param.Name, nil)
+}
+
+var exampleHandler9 = func(c *gin.Context) {
+	common.SendResponseWithStatus(c, http.StatusCreated, "created", nil)
+}
+
+var exampleHandler10 = func(c *gin.Context) {
+	common.SendResponseWithStatus(c, http.StatusCreated, nil, errors.Occur(errors.ErrBadRequest, "invalid"))
+}
+
+var exampleTimeoutHandler = func(c *gin.Context) {
+	ctx := common.NewContextWithTraceId(c)
+	_, err := shell.ShellImpl{}.NewCommand("sleep 5").WithContext(ctx).Execute()
+	sendResponse(c, nil, err)
+}
+
 func singleExample() (string, *errors.OcpAgentError) {
 	return "this is data", nil
 }
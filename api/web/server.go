@@ -29,8 +29,13 @@ import (
 	"github.com/oceanbase/obagent/executor/agent"
 	http2 "github.com/oceanbase/obagent/lib/http"
 	path2 "github.com/oceanbase/obagent/lib/path"
+	"github.com/oceanbase/obagent/lib/shell"
 )
 
+// shellShutdownTimeout is the time to wait for running shell commands to finish when the server stops,
+// after the running tasks finish, the commands still running after it are killed.
+const shellShutdownTimeout = 30 * time.Second
+
 type Server struct {
 	Config          mgrconfig.ServerConfig
 	Router          *gin.Engine
@@ -112,10 +117,16 @@ func (s *Server) Stop() {
 	err := s.HttpServer.Shutdown(context.Background())
 	log.WithError(err).Error("stop http server got error")
 	s.state.Set(http2.Stopped)
-	// TODO: wait command finished
+	// let the running tasks, e.g. of OB maintenance, finish all their steps instead of killing them by exiting,
+	// shell commands are only refused once the tasks finish
 	for mgrroute.TaskCount() > 0 {
 		time.Sleep(time.Second)
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), shellShutdownTimeout)
+	defer cancel()
+	if err := shell.Shutdown(ctx); err != nil {
+		log.WithError(err).Warn("wait shell commands finished got error")
+	}
 }
 
 func (s *Server) State() http2.State {
@@ -155,6 +155,41 @@ func setLogConfigPropertyMeta() {
 			ValueType:    config.ValueBool,
 		})
 
+	config.SetConfigPropertyMeta(
+		&config.ConfigProperty{
+			Key:          "monagent.log.format",
+			DefaultValue: "text",
+			ValueType:    config.ValueString,
+		})
+
+	config.SetConfigPropertyMeta(
+		&config.ConfigProperty{
+			Key:          "monagent.log.rotate.interval",
+			DefaultValue: "0s",
+			ValueType:    config.ValueString,
+		})
+
+	config.SetConfigPropertyMeta(
+		&config.ConfigProperty{
+			Key:          "monagent.log.sample.burst",
+			DefaultValue: "0",
+			ValueType:    config.ValueInt64,
+		})
+
+	config.SetConfigPropertyMeta(
+		&config.ConfigProperty{
+			Key:          "monagent.log.sample.interval",
+			DefaultValue: "1s",
+			ValueType:    config.ValueString,
+		})
+
+	config.SetConfigPropertyMeta(
+		&config.ConfigProperty{
+			Key:          "monagent.log.disable.masking",
+			DefaultValue: "false",
+			ValueType:    config.ValueBool,
+		})
+
 	config.SetConfigPropertyMeta(
 		&config.ConfigProperty{
 			Key:          "mgragent.log.level",
@@ -190,6 +225,41 @@ func setLogConfigPropertyMeta() {
 			ValueType:    config.ValueBool,
 		})
 
+	config.SetConfigPropertyMeta(
+		&config.ConfigProperty{
+			Key:          "mgragent.log.format",
+			DefaultValue: "text",
+			ValueType:    config.ValueString,
+		})
+
+	config.SetConfigPropertyMeta(
+		&config.ConfigProperty{
+			Key:          "mgragent.log.rotate.interval",
+			DefaultValue: "0s",
+			ValueType:    config.ValueString,
+		})
+
+	config.SetConfigPropertyMeta(
+		&config.ConfigProperty{
+			Key:          "mgragent.log.sample.burst",
+			DefaultValue: "0",
+			ValueType:    config.ValueInt64,
+		})
+
+	config.SetConfigPropertyMeta(
+		&config.ConfigProperty{
+			Key:          "mgragent.log.sample.interval",
+			DefaultValue: "1s",
+			ValueType:    config.ValueString,
+		})
+
+	config.SetConfigPropertyMeta(
+		&config.ConfigProperty{
+			Key:          "mgragent.log.disable.masking",
+			DefaultValue: "false",
+			ValueType:    config.ValueBool,
+		})
+
 	config.SetConfigPropertyMeta(
 		&config.ConfigProperty{
 			Key:          "config.version.maxbackups",
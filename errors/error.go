@@ -43,3 +43,39 @@ func Occur(errorCode ErrorCode, args ...interface{}) *OcpAgentError {
 		Args:      args,
 	}
 }
+
+// AgentError is an error with an explicit error code, HTTP status and message,
+// for errors whose message is not defined in the i18n resources.
+// It implements error interface.
+type AgentError struct {
+	Code    int    // error code
+	Status  int    // HTTP status code
+	Message string // error message
+}
+
+func (e AgentError) Error() string {
+	return fmt.Sprintf("AgentError: code = %d, status = %d, message = %s", e.Code, e.Status, e.Message)
+}
+
+func NewAgentError(code int, status int, message string) *AgentError {
+	return &AgentError{
+		Code:    code,
+		Status:  status,
+		Message: message,
+	}
+}
+
+// NewBadRequestError creates an error for a request with invalid parameters.
+func NewBadRequestError(code int, message string) *AgentError {
+	return NewAgentError(code, badRequest, message)
+}
+
+// NewNotFoundError creates an error for a request of a resource that does not exist.
+func NewNotFoundError(code int, message string) *AgentError {
+	return NewAgentError(code, notFound, message)
+}
+
+// NewInternalError creates an error for a request failed by the agent itself, e.g. a command failed.
+func NewInternalError(code int, message string) *AgentError {
+	return NewAgentError(code, unexpected, message)
+}
@@ -27,3 +27,15 @@ func TestErrorOccur(t *testing.T) {
 	assert.Contains(t, message, strconv.Itoa(e.Code))
 	assert.Contains(t, message, args)
 }
+
+func TestAgentError(t *testing.T) {
+	err := NewBadRequestError(1001, "invalid param")
+	assert.Equal(t, 400, err.Status)
+	message := err.Error()
+	assert.Contains(t, message, "1001")
+	assert.Contains(t, message, "invalid param")
+
+	var agentErr *AgentError
+	assert.True(t, As(Wrap(err, "wrapped"), &agentErr))
+	assert.Equal(t, err, agentErr)
+}
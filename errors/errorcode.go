@@ -22,8 +22,16 @@ const (
 	notFound        ErrorKind = http.StatusNotFound
 	unexpected      ErrorKind = http.StatusInternalServerError
 	notImplemented  ErrorKind = http.StatusNotImplemented
+	unavailable     ErrorKind = http.StatusServiceUnavailable
+	tooManyRequests ErrorKind = http.StatusTooManyRequests
+	tooLarge        ErrorKind = http.StatusRequestEntityTooLarge
 )
 
+// LibErrorCodeBase is the base of the codes of client errors of lib/errors in responses,
+// the code of such an error is the base plus the id of its kind, e.g. 1152 of NOT_FOUND,
+// so that they do not collide with the codes of the agent. The range 1100 ~ 1199 of general error codes is reserved for them.
+const LibErrorCodeBase = 1100
+
 type ErrorCode struct {
 	Code int
 	Kind ErrorKind
@@ -47,6 +55,9 @@ var (
 	ErrBadRequest      = NewErrorCode(1000, badRequest, "err.bad.request")
 	ErrIllegalArgument = NewErrorCode(1001, illegalArgument, "err.illegal.argument")
 	ErrUnexpected      = NewErrorCode(1002, unexpected, "err.unexpected")
+	ErrRequestTimeout  = NewErrorCode(1003, unavailable, "err.request.timeout")
+	ErrTooManyRequests = NewErrorCode(1004, tooManyRequests, "err.too.many.requests")
+	ErrRequestTooLarge = NewErrorCode(1005, tooLarge, "err.request.too.large")
 
 	// shell execute error codes
 	ErrExecuteCommand = NewErrorCode(1500, unexpected, "err.execute.command")
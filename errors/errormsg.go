@@ -40,12 +40,26 @@ func loadBundleMessage(assetName string) {
 
 // GetMessage Get localized error message
 func GetMessage(lang language.Tag, errorCode ErrorCode, args []interface{}) string {
+	message, ok := getMessageByKey(lang, errorCode.key, args)
+	if !ok {
+		return errorCode.key
+	}
+	return message
+}
+
+// GetDefaultMessageByKey returns the message of key in the default language formatted with args,
+// ok is false if key is not defined, e.g. the keys of validation errors.
+func GetDefaultMessageByKey(key string, args ...interface{}) (string, bool) {
+	return getMessageByKey(defaultLanguage, key, args)
+}
+
+func getMessageByKey(lang language.Tag, key string, args []interface{}) (string, bool) {
 	localizer := i18n.NewLocalizer(bundle, lang.String())
 	message, err := localizer.Localize(&i18n.LocalizeConfig{
-		MessageID: errorCode.key,
+		MessageID: key,
 	})
 	if err != nil {
-		return errorCode.key
+		return "", false
 	}
-	return fmt.Sprintf(message, args...)
+	return fmt.Sprintf(message, args...), true
 }
@@ -24,3 +24,15 @@ func TestErrorCode_HasMessage(t *testing.T) {
 		}
 	}
 }
+
+func TestValidationMessages(t *testing.T) {
+	// tags of the validator used by the request params
+	for _, tag := range []string{"required", "required_if", "min", "max", "oneof"} {
+		if _, ok := GetDefaultMessageByKey("err.validation."+tag, "Field", "param"); !ok {
+			t.Errorf("validation tag %v has no i18n message defined", tag)
+		}
+	}
+	if message, _ := GetDefaultMessageByKey("err.validation.required", "Name", ""); message != "Name is required" {
+		t.Errorf("wrong message %v", message)
+	}
+}
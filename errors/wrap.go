@@ -29,3 +29,7 @@ func Wrap(err error, message string) error {
 func Wrapf(err error, format string, args ...interface{}) error {
 	return errors.Wrapf(err, format, args...)
 }
+
+func As(err error, target interface{}) bool {
+	return errors.As(err, target)
+}
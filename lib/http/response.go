@@ -22,6 +22,7 @@ import (
 	"github.com/go-playground/validator/v10"
 
 	"github.com/oceanbase/obagent/errors"
+	liberrors "github.com/oceanbase/obagent/lib/errors"
 )
 
 // OcpAgentResponse defines basic API return structure for HTTP responses.
@@ -34,6 +35,8 @@ type OcpAgentResponse struct {
 	Server     string      `json:"server"`          // Server's internal IP address
 	Data       interface{} `json:"data,omitempty"`  // Data payload when response is successful
 	Error      *ApiError   `json:"error,omitempty"` // Error payload when response is failed
+
+	ServerTimestamp time.Time `json:"serverTimestamp"` // Server time when the response is sent, to detect clock skew
 }
 
 type ocpAgentResponseJson struct {
@@ -45,6 +48,8 @@ type ocpAgentResponseJson struct {
 	Server     string          `json:"server"`          // Server's internal IP address
 	Data       json.RawMessage `json:"data,omitempty"`  // Data payload when response is successful
 	Error      *ApiError       `json:"error,omitempty"` // Error payload when response is failed
+
+	ServerTimestamp time.Time `json:"serverTimestamp"` // Server time when the response is sent, to detect clock skew
 }
 
 func (r *OcpAgentResponse) UnmarshalJSON(b []byte) error {
@@ -60,6 +65,7 @@ func (r *OcpAgentResponse) UnmarshalJSON(b []byte) error {
 	r.TraceId = j.TraceId
 	r.Server = j.Server
 	r.Error = j.Error
+	r.ServerTimestamp = j.ServerTimestamp
 	v := reflect.ValueOf(r.Data)
 	if !v.IsValid() {
 		err = json.Unmarshal(j.Data, &r.Data)
@@ -104,14 +110,33 @@ type ApiFieldError struct {
 	Tag     string `json:"tag"`
 	Field   string `json:"field"`
 	Message string `json:"message"`
+	Key     string `json:"key"` // i18n message key of the failed validation, e.g. err.validation.required
 }
 
+const validationMessageKeyPrefix = "err.validation."
+
 func NewApiFieldError(fieldError validator.FieldError) ApiFieldError {
+	key := validationMessageKeyPrefix + fieldError.Tag()
+	// messages of the keys take the field and the param of the tag, the error of the validator is kept for other tags
+	message, ok := errors.GetDefaultMessageByKey(key, fieldError.Field(), fieldError.Param())
+	if !ok {
+		message = fieldError.Error()
+	}
 	return ApiFieldError{
 		Tag:     fieldError.Tag(),
 		Field:   fieldError.Field(),
-		Message: fieldError.Error(),
+		Message: message,
+		Key:     key,
+	}
+}
+
+// NewApiFieldErrors converts validation errors to sub errors of a response, one for each field.
+func NewApiFieldErrors(validationErrors validator.ValidationErrors) []interface{} {
+	subErrors := make([]interface{}, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		subErrors = append(subErrors, NewApiFieldError(fieldError))
 	}
+	return subErrors
 }
 
 type ApiUnknownError struct {
@@ -175,13 +200,39 @@ func NewSubErrorsResponse(subErrors []interface{}) OcpAgentResponse {
 	}
 }
 
+func NewAgentErrorResponse(err *errors.AgentError) OcpAgentResponse {
+	return OcpAgentResponse{
+		Successful: false,
+		Timestamp:  time.Now(),
+		Status:     err.Status,
+		Data:       nil,
+		Error: &ApiError{
+			Code:    err.Code,
+			Message: err.Message,
+		},
+	}
+}
+
+// BuildResponse builds the response of data, or of err if it is not nil.
+// Errors are mapped by their type, also when wrapped: validation errors are bad requests with an error of each field,
+// *errors.OcpAgentError and *errors.AgentError keep their code and status,
+// errors of lib/errors keep the status of their kind, and the code of their kind in the range reserved for them
+// if they are client errors, e.g. 1152 of NOT_FOUND, see errors.LibErrorCodeBase,
+// client errors of unknown kinds are bad requests, others are unexpected errors.
+// The server timestamp is the time it is built, PostHandlers updates it when the response is sent.
 func BuildResponse(data interface{}, err error) OcpAgentResponse {
-	agenterr, ok := err.(*errors.OcpAgentError)
-	if !ok && err != nil {
-		agenterr = errors.Occur(errors.ErrUnexpected, err)
+	resp := buildResponse(data, err)
+	resp.ServerTimestamp = resp.Timestamp
+	return resp
+}
+
+func buildResponse(data interface{}, err error) OcpAgentResponse {
+	// handlers may return a nil *errors.OcpAgentError as error, it is not an error
+	if agentErr, ok := err.(*errors.OcpAgentError); ok && agentErr == nil {
+		err = nil
 	}
-	if agenterr != nil {
-		return NewErrorResponse(agenterr)
+	if err != nil {
+		return buildErrorResponse(err)
 	}
 
 	if data != nil && reflect.TypeOf(data).Kind() == reflect.Slice {
@@ -191,3 +242,30 @@ func BuildResponse(data interface{}, err error) OcpAgentResponse {
 		return NewSuccessResponse(data)
 	}
 }
+
+func buildErrorResponse(err error) OcpAgentResponse {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		return NewSubErrorsResponse(NewApiFieldErrors(validationErrors))
+	}
+	var agentErr *errors.OcpAgentError
+	if errors.As(err, &agentErr) {
+		return NewErrorResponse(agentErr)
+	}
+	var typedErr *errors.AgentError
+	if errors.As(err, &typedErr) {
+		return NewAgentErrorResponse(typedErr)
+	}
+	var libErr *liberrors.Error
+	if errors.As(err, &libErr) {
+		code := errors.ErrUnexpected.Code
+		if status := libErr.HttpCode(); status >= http.StatusBadRequest && status < http.StatusInternalServerError {
+			code = errors.ErrBadRequest.Code
+			if kind := libErr.Kind(); liberrors.KindByName(kind.Name) == kind {
+				code = errors.LibErrorCodeBase + kind.Id
+			}
+		}
+		return NewAgentErrorResponse(errors.NewAgentError(code, libErr.HttpCode(), libErr.Message()))
+	}
+	return NewErrorResponse(errors.Occur(errors.ErrUnexpected, err))
+}
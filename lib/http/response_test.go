@@ -15,7 +15,13 @@ package http
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oceanbase/obagent/errors"
+	liberrors "github.com/oceanbase/obagent/lib/errors"
 )
 
 type S struct {
@@ -57,3 +63,39 @@ func TestJson(t *testing.T) {
 	}
 	fmt.Println(resp.Data)
 }
+
+func TestBuildResponseError(t *testing.T) {
+	resp := BuildResponse(nil, errors.NewBadRequestError(1001, "invalid param"))
+	assert.False(t, resp.Successful)
+	assert.Equal(t, http.StatusBadRequest, resp.Status)
+	assert.Equal(t, 1001, resp.Error.Code)
+	assert.Equal(t, "invalid param", resp.Error.Message)
+
+	// wrapped errors keep their code
+	resp = BuildResponse(nil, errors.Wrap(errors.NewNotFoundError(2300, "task not found"), "query task"))
+	assert.Equal(t, http.StatusNotFound, resp.Status)
+	assert.Equal(t, 2300, resp.Error.Code)
+
+	resp = BuildResponse(nil, errors.Occur(errors.ErrExecuteCommand, "exit 1"))
+	assert.Equal(t, http.StatusInternalServerError, resp.Status)
+	assert.Equal(t, errors.ErrExecuteCommand.Code, resp.Error.Code)
+
+	resp = BuildResponse(nil, liberrors.InvalidArgument.NewCode("test", "invalid").NewError())
+	assert.Equal(t, http.StatusBadRequest, resp.Status)
+	assert.Equal(t, errors.LibErrorCodeBase+liberrors.InvalidArgument.Id, resp.Error.Code)
+
+	resp = BuildResponse(nil, liberrors.NotFound.NewCode("test", "not_found").NewError())
+	assert.Equal(t, http.StatusNotFound, resp.Status)
+	assert.Equal(t, 1152, resp.Error.Code)
+
+	// client errors of unknown kinds are bad requests
+	unknownKind := liberrors.Kind{Id: 99, Name: "UNKNOWN_CLIENT_ERROR", HttpCode: http.StatusConflict}
+	resp = BuildResponse(nil, unknownKind.NewCode("test", "unknown").NewError())
+	assert.Equal(t, http.StatusConflict, resp.Status)
+	assert.Equal(t, errors.ErrBadRequest.Code, resp.Error.Code)
+
+	// unknown errors are unexpected errors
+	resp = BuildResponse(nil, fmt.Errorf("unknown"))
+	assert.Equal(t, http.StatusInternalServerError, resp.Status)
+	assert.Equal(t, errors.ErrUnexpected.Code, resp.Error.Code)
+}
@@ -67,6 +67,16 @@ type Status struct {
 	Ports []int `json:"ports"`
 }
 
+// Health liveness check api response
+type Health struct {
+	//service version
+	Version string `json:"version"`
+	//seconds since service started
+	Uptime int64 `json:"uptime"`
+	//whether shell commands can be executed, only checked in deep mode
+	Exec bool `json:"exec,omitempty"`
+}
+
 type StateHolder struct {
 	state State
 }
@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package mask
+
+import "context"
+
+type unmaskedKey struct{}
+
+// WithUnmasked returns a context with which MaskFromContext keeps texts as is.
+// It is meant for trusted debug sessions only, see common.UnmaskDebugHandler.
+func WithUnmasked(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unmaskedKey{}, true)
+}
+
+// IsUnmasked reports whether masking is disabled by ctx.
+func IsUnmasked(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	unmasked, _ := ctx.Value(unmaskedKey{}).(bool)
+	return unmasked
+}
+
+// MaskFromContext masks text like Mask, unless masking is disabled by ctx with WithUnmasked.
+func MaskFromContext(ctx context.Context, text string) string {
+	if IsUnmasked(ctx) {
+		return text
+	}
+	return Mask(text)
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package mask
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// maskedValue replaces the masked values, the same as the default rules of Mask.
+const maskedValue = "xxx"
+
+// MaskJSON replaces the values of the keys in JSON data with a masked value, whatever their types are.
+// Keys are matched case-insensitively in objects at any depth, and the order of the fields is kept.
+// Data that is not valid JSON is returned unchanged.
+func MaskJSON(data []byte, keys []string) []byte {
+	if len(keys) == 0 || !json.Valid(data) {
+		return data
+	}
+	keySet := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		keySet[strings.ToLower(key)] = true
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := maskJSONValue(dec, &buf, keySet, false); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
+
+func maskJSONValue(dec *json.Decoder, buf *bytes.Buffer, keys map[string]bool, masked bool) error {
+	if masked {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		return writeJSON(buf, maskedValue)
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return writeJSON(buf, tok)
+	}
+	buf.WriteByte(byte(delim))
+	for i := 0; dec.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		maskValue := false
+		if delim == '{' {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := keyTok.(string)
+			if err := writeJSON(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			maskValue = keys[strings.ToLower(key)]
+		}
+		if err := maskJSONValue(dec, buf, keys, maskValue); err != nil {
+			return err
+		}
+	}
+	// the closing delimiter
+	end, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	buf.WriteByte(byte(end.(json.Delim)))
+	return nil
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) error {
+	if n, ok := v.(json.Number); ok {
+		buf.WriteString(n.String())
+		return nil
+	}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	// Encode appends a newline
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
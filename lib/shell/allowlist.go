@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// commandAllowlist limits the commands that can be run, it allows all commands by default.
+var commandAllowlist allowlist
+
+// Allowlist is the set of commands allowed to run, see SetAllowlist.
+type Allowlist struct {
+	// Programs are the programs allowed to run as they are given in commands, e.g. /bin/df, matched exactly.
+	// A command built by NewCommand matches only if it runs a single program without shell operators like ; or |.
+	// A command run by a program other than the default shell, see WithProgram, is only allowed if the program
+	// is in Programs too, e.g. bash, no matter whether the command matches, as the command is run by the program.
+	Programs []string
+	// Patterns are matched against the full command, they should be anchored by ^ and $ to match it entirely.
+	Patterns []*regexp.Regexp
+}
+
+type allowlist struct {
+	mu       sync.RWMutex
+	programs map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// shellOperators are characters by which a shell command may run programs other than its first one.
+const shellOperators = ";&|`$()<>\n"
+
+// SetAllowlist limits the commands run by Execute and its variants, Start and ExecuteStream to the ones in list.
+// A command not allowed fails with ErrCommandNotAllowed without running. An empty list allows all commands, which is the default.
+func SetAllowlist(list Allowlist) {
+	programs := make(map[string]bool, len(list.Programs))
+	for _, program := range list.Programs {
+		programs[program] = true
+	}
+	commandAllowlist.mu.Lock()
+	defer commandAllowlist.mu.Unlock()
+	commandAllowlist.programs = programs
+	commandAllowlist.patterns = append([]*regexp.Regexp(nil), list.Patterns...)
+}
+
+func (l *allowlist) allows(c *command) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(l.programs) == 0 && len(l.patterns) == 0 {
+		return true
+	}
+	if c.argv == nil && c.program != defaultProgram && !l.programs[string(c.program)] {
+		return false
+	}
+	for _, pattern := range l.patterns {
+		if pattern.MatchString(c.cmd) {
+			return true
+		}
+	}
+	if program := c.programPath(); program != "" {
+		return l.programs[program]
+	}
+	return false
+}
+
+// programPath returns the program run by the command, or "" if it may run more than one program.
+func (c *command) programPath() string {
+	if c.argv != nil {
+		return c.argv[0]
+	}
+	if c.script || strings.ContainsAny(c.cmd, shellOperators) {
+		return ""
+	}
+	fields := strings.Fields(c.cmd)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// validateAllowlist checks that the command is allowed by SetAllowlist.
+func (c *command) validateAllowlist() error {
+	if !commandAllowlist.allows(c) {
+		return ErrCommandNotAllowed
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetAllowlist(t *testing.T) {
+	SetAllowlist(Allowlist{
+		Programs: []string{"echo", "/bin/true"},
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`^df -h [\w/]+$`)},
+	})
+	defer SetAllowlist(Allowlist{})
+
+	_, err := libShell.NewCommand("echo a").Execute()
+	assert.NoError(t, err)
+	_, err = libShell.NewArgsCommand("/bin/true").Execute()
+	assert.NoError(t, err)
+	_, err = libShell.NewCommand("df -h /").Execute()
+	assert.NoError(t, err)
+
+	for _, cmd := range []Command{
+		libShell.NewCommand("rm -rf /tmp/obagent_not_exist"),
+		libShell.NewCommand("echo a; rm -rf /tmp/obagent_not_exist"),
+		libShell.NewCommand("echo $(rm -rf /tmp/obagent_not_exist)"),
+		libShell.NewCommand("df -h / && rm -rf /tmp/obagent_not_exist"),
+		libShell.NewScript("echo a"),
+		libShell.NewCommand("echo a").WithProgram("python3"),
+		libShell.NewCommand("df -h /").WithProgram(Bash),
+	} {
+		_, err = cmd.Execute()
+		assert.True(t, errors.Is(err, ErrCommandNotAllowed), cmd.Cmd())
+		_, err = cmd.Start()
+		assert.True(t, errors.Is(err, ErrCommandNotAllowed), cmd.Cmd())
+	}
+	lines, errCh := libShell.NewCommand("rm -rf /tmp/obagent_not_exist").ExecuteStream(context.Background())
+	for range lines {
+	}
+	assert.True(t, errors.Is(<-errCh, ErrCommandNotAllowed))
+
+	// the program running the command is allowed too
+	SetAllowlist(Allowlist{Programs: []string{"echo", string(Bash)}})
+	_, err = libShell.NewCommand("echo a").WithProgram(Bash).Execute()
+	assert.NoError(t, err)
+
+	SetAllowlist(Allowlist{})
+	_, err = libShell.NewCommand("echo a; echo b").Execute()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,30 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import "regexp"
+
+// ansiCSIPattern matches ANSI CSI escape sequences, e.g. the color codes "\x1b[31m" and "\x1b[0m".
+var ansiCSIPattern = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]`)
+
+// WithStripANSI makes ANSI escape sequences removed from the captured output,
+// for tools that emit colors even when the output is not a terminal.
+func (c *command) WithStripANSI() Command {
+	c.stripANSI = true
+	return c
+}
+
+// StripANSI removes ANSI CSI escape sequences from s.
+func StripANSI(s string) string {
+	return ansiCSIPattern.ReplaceAllString(s, "")
+}
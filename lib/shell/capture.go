@@ -0,0 +1,390 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// truncatedMarker is appended to the captured output when it exceeds the max output bytes.
+const truncatedMarker = "\n...[output truncated]"
+
+// outputCapture collects stdout and stderr of a command separately, and both of them interleaved.
+// exec.Cmd copies stdout and stderr in separate goroutines, so writes are serialized by a lock.
+type outputCapture struct {
+	mu         sync.Mutex
+	maxBytes   int             // max bytes of output to keep, 0 means unlimited
+	stdOutput  bool            // whether stdout is the output, then maxBytes applies to stdout and stderr separately
+	idle       *idleWatch      // reset on each write if not nil
+	throttle   *outputThrottle // delays each write to limit the output rate if not nil
+	abort      chan error      // receives the reason to kill the command for its output, e.g. ErrIdleTimeout
+	sink       io.Writer       // if not nil, stdout is written to it instead of kept
+	sinkStderr bool            // whether stderr is also written to sink
+	dropStderr bool            // whether stderr is discarded instead of kept, it still resets the idle timer
+	stdout     captureBuffer
+	stderr     captureBuffer
+	combined   captureBuffer
+	timeline   *outputTimeline // records the time of each kept line if not nil
+	hash       hash.Hash       // fed with all of stdout, and stderr if hashStderr, before truncation if not nil
+	hashStderr bool
+}
+
+type captureBuffer struct {
+	bytes.Buffer
+	truncated bool
+	lines     *lineBuffer // keeps the head and tail lines instead of the Buffer if not nil
+}
+
+func (b *captureBuffer) keep(p []byte) {
+	if b.lines != nil {
+		b.lines.Write(p)
+		return
+	}
+	b.Buffer.Write(p)
+}
+
+func (b *captureBuffer) Len() int {
+	if b.lines != nil {
+		return b.lines.size
+	}
+	return b.Buffer.Len()
+}
+
+// raw returns the kept output without the truncated marker.
+func (b *captureBuffer) raw() string {
+	if b.lines != nil {
+		return b.lines.String()
+	}
+	return b.Buffer.String()
+}
+
+func (b *captureBuffer) String() string {
+	if b.truncated {
+		return b.raw() + truncatedMarker
+	}
+	return b.raw()
+}
+
+// elided reports whether any line is dropped by the line limit.
+func (b *captureBuffer) elided() bool {
+	return b.lines != nil && b.lines.elided() > 0
+}
+
+// lineBuffer keeps the first head lines and the last tail lines written to it, the lines in between are dropped,
+// and are replaced by a marker of how many of them. The tail lines are kept in a ring, so that the memory is bounded
+// by the lines kept, no matter how many lines are written.
+type lineBuffer struct {
+	head      int
+	tail      int
+	headBuf   bytes.Buffer
+	headLines int
+	ring      []string // last complete lines, ring[next] is the oldest one when it is full
+	next      int
+	partial   []byte // the incomplete last line, not in the ring yet
+	pending   bool   // whether there is an incomplete last line dropped, for no tail
+	dropped   int    // number of complete lines dropped
+	size      int    // bytes kept
+}
+
+func newLineBuffer(head, tail int) *lineBuffer {
+	return &lineBuffer{head: head, tail: tail}
+}
+
+func (b *lineBuffer) Write(p []byte) {
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if b.headLines < b.head {
+			if i < 0 {
+				b.headBuf.Write(p)
+				b.size += len(p)
+				return
+			}
+			b.headBuf.Write(p[:i+1])
+			b.size += i + 1
+			b.headLines++
+			p = p[i+1:]
+			continue
+		}
+		if b.tail == 0 {
+			// nothing but the number of lines is kept
+			if i < 0 {
+				b.pending = true
+				return
+			}
+			b.pending = false
+			b.dropped++
+			p = p[i+1:]
+			continue
+		}
+		if i < 0 {
+			b.partial = append(b.partial, p...)
+			b.size += len(p)
+			return
+		}
+		b.size += i + 1
+		b.push(string(append(b.partial, p[:i+1]...)))
+		b.partial = b.partial[:0]
+		p = p[i+1:]
+	}
+}
+
+// push adds a complete line to the tail, dropping the oldest one if the tail is full.
+func (b *lineBuffer) push(line string) {
+	if len(b.ring) < b.tail {
+		b.ring = append(b.ring, line)
+		return
+	}
+	b.size -= len(b.ring[b.next])
+	b.ring[b.next] = line
+	b.next = (b.next + 1) % b.tail
+	b.dropped++
+}
+
+// skipped returns the number of the oldest lines in the ring not shown, an incomplete last line takes the place of one.
+func (b *lineBuffer) skipped() int {
+	if len(b.partial) > 0 && b.tail > 0 && len(b.ring) == b.tail {
+		return 1
+	}
+	return 0
+}
+
+// elided returns the number of lines dropped, including an incomplete last line not kept.
+func (b *lineBuffer) elided() int {
+	if b.pending {
+		return b.dropped + 1
+	}
+	return b.dropped + b.skipped()
+}
+
+func (b *lineBuffer) String() string {
+	var s strings.Builder
+	s.Write(b.headBuf.Bytes())
+	if elided := b.elided(); elided > 0 {
+		fmt.Fprintf(&s, "...[%d lines omitted]\n", elided)
+	}
+	for i := b.skipped(); i < len(b.ring); i++ {
+		s.WriteString(b.ring[(b.next+i)%len(b.ring)])
+	}
+	s.Write(b.partial)
+	return s.String()
+}
+
+type captureWriter struct {
+	capture *outputCapture
+	buf     *captureBuffer
+	toSink  bool
+	stream  OutputStream
+}
+
+// Write keeps at most maxBytes of output and drops the rest. The bytes are counted in the buffer returned as the output,
+// the combined output, or stdout and stderr separately if stdout is the output.
+// It never fails, so that the command is not broken by a full buffer.
+func (w *captureWriter) Write(p []byte) (int, error) {
+	throttle := w.capture.throttle
+	if throttle == nil {
+		return w.write(p)
+	}
+	// the copy from the pipe waits, so that the command blocks on writing when its output is too fast,
+	// a large write waits chunk by chunk, so that it is not delayed for long once the command is terminated
+	n := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > throttle.chunkSize() {
+			chunk = chunk[:throttle.chunkSize()]
+		}
+		throttle.wait(len(chunk))
+		written, err := w.write(chunk)
+		n += written
+		if err != nil {
+			return n, err
+		}
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+func (w *captureWriter) write(p []byte) (int, error) {
+	w.capture.mu.Lock()
+	defer w.capture.mu.Unlock()
+	if w.capture.idle != nil {
+		w.capture.idle.touch()
+	}
+	if w.capture.hash != nil && (w.stream == StdoutStream || w.capture.hashStderr) {
+		_, _ = w.capture.hash.Write(p)
+	}
+	if w.toSink {
+		// errors of the sink stop copying the output, and are returned by waiting for the command
+		return w.capture.sink.Write(p)
+	}
+	n := len(p)
+	if w.stream == StderrStream && w.capture.dropStderr {
+		return n, nil
+	}
+	kept := p
+	if w.capture.maxBytes > 0 {
+		budget := &w.capture.combined
+		if w.capture.stdOutput {
+			budget = w.buf
+		}
+		remaining := w.capture.maxBytes - budget.Len()
+		if remaining < 0 {
+			remaining = 0
+		}
+		if len(kept) > remaining {
+			kept = kept[:remaining]
+			w.buf.truncated = true
+			w.capture.combined.truncated = true
+		}
+	}
+	w.buf.keep(kept)
+	w.capture.combined.keep(kept)
+	if w.capture.timeline != nil {
+		w.capture.timeline.write(w.stream, kept, time.Now())
+	}
+	return n, nil
+}
+
+func (o *outputCapture) stdoutWriter() io.Writer {
+	return &captureWriter{capture: o, buf: &o.stdout, toSink: o.sink != nil, stream: StdoutStream}
+}
+
+func (o *outputCapture) stderrWriter() io.Writer {
+	return &captureWriter{capture: o, buf: &o.stderr, toSink: o.sink != nil && o.sinkStderr, stream: StderrStream}
+}
+
+// rawOutput returns stdout for StdOutput, or the combined output otherwise, without the truncated marker,
+// and whether it is truncated.
+func (o *outputCapture) rawOutput(outputType OutputType) (string, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if outputType == StdOutput {
+		return o.stdout.raw(), o.stdout.truncated
+	}
+	return o.combined.raw(), o.combined.truncated
+}
+
+func (o *outputCapture) streams() (stdout string, stderr string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.stdout.String(), o.stderr.String()
+}
+
+// digest returns the digest of the output fed to the hash, or nil if there is no hash.
+func (o *outputCapture) digest() []byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.hash == nil {
+		return nil
+	}
+	return o.hash.Sum(nil)
+}
+
+// throttled returns the time the output is delayed by the rate limit.
+func (o *outputCapture) throttled() time.Duration {
+	if o.throttle == nil {
+		return 0
+	}
+	return o.throttle.total()
+}
+
+// truncated reports whether any output is dropped.
+func (o *outputCapture) truncated() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.combined.truncated || o.combined.elided() || o.stdout.elided()
+}
+
+// terminatePolicy returns the policy of terminating the command writing to the capture, which stops delaying
+// the output, so that waiting for the command is not blocked by the throttle once it is terminated.
+func (o *outputCapture) terminatePolicy(policy terminatePolicy) terminatePolicy {
+	policy.onTerminate = o.stopThrottle
+	return policy
+}
+
+// stopThrottle stops delaying the output once the command is terminated, see outputThrottle.stop.
+func (o *outputCapture) stopThrottle() {
+	if o.throttle != nil {
+		o.throttle.stop()
+	}
+}
+
+// newOutputCapture creates the capture of the command output according to the output options of the command.
+func (c *command) newOutputCapture() *outputCapture {
+	o := &outputCapture{
+		maxBytes:   c.maxOutput,
+		stdOutput:  c.outputType == StdOutput,
+		sink:       c.outputWriter,
+		sinkStderr: c.outputType != StdOutput,
+		dropStderr: c.outputType == StdOutput && !c.keepStderr,
+		abort:      make(chan error, 1),
+	}
+	if c.outputRate.bytesPerSec > 0 {
+		o.throttle = newOutputThrottle(c.outputRate.bytesPerSec, c.outputRate.killAfter, o.abort)
+	}
+	if c.maxLines.head > 0 || c.maxLines.tail > 0 {
+		o.stdout.lines = newLineBuffer(c.maxLines.head, c.maxLines.tail)
+		o.stderr.lines = newLineBuffer(c.maxLines.head, c.maxLines.tail)
+		o.combined.lines = newLineBuffer(c.maxLines.head, c.maxLines.tail)
+	}
+	if c.timestamped {
+		o.timeline = newOutputTimeline()
+	}
+	if c.outputHash != nil {
+		c.outputHash.Reset()
+		o.hash = c.outputHash
+		o.hashStderr = c.outputType != StdOutput
+	}
+	return o
+}
+
+// idleWatch sends ErrIdleTimeout to abort when it is not touched for the timeout.
+type idleWatch struct {
+	timeout time.Duration
+	timer   *time.Timer
+	once    sync.Once
+}
+
+func newIdleWatch(timeout time.Duration, abort chan<- error) *idleWatch {
+	w := &idleWatch{
+		timeout: timeout,
+	}
+	w.timer = time.AfterFunc(timeout, func() {
+		w.once.Do(func() {
+			sendAbort(abort, ErrIdleTimeout)
+		})
+	})
+	return w
+}
+
+// sendAbort sends the reason to abort unless another one is sent already.
+func sendAbort(abort chan<- error, reason error) {
+	select {
+	case abort <- reason:
+	default:
+	}
+}
+
+// touch restarts the idle timer.
+func (w *idleWatch) touch() {
+	w.timer.Reset(w.timeout)
+}
+
+func (w *idleWatch) stop() {
+	w.timer.Stop()
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// cgroupParent is the cgroup under the root of the hierarchy to hold the transient cgroups of commands,
+// it has no processes of its own so that controllers can be enabled for its children.
+const cgroupParent = "obagent-shell"
+
+// cgroupLimits is the cgroup v2 resource limits of a command.
+type cgroupLimits struct {
+	cpuMax     string // content of cpu.max, e.g. "50000 100000" for half a CPU, empty means no CPU limit
+	memMax     int64  // content of memory.max in bytes, 0 means no memory limit
+	bestEffort bool   // run the command without limits instead of failing when cgroup is not available
+}
+
+// cgroup is a transient cgroup created for a single run of a command.
+type cgroup struct {
+	dir string
+}
+
+// WithCgroup runs the command in a transient cgroup v2 with the CPU and memory limits, so that an expensive command
+// can not starve the database. cpuMax is in the format of cpu.max, "$MAX $PERIOD" in microseconds, empty means no limit.
+// memMax is in bytes, 0 means no limit. The process moves itself into the cgroup before it execs the command, so that
+// the command and all the processes it forks run in the cgroup, and the cgroup is removed after the command exits.
+// The resolved command shows the wrapper.
+// By default the command fails if cgroup v2 is not available, see WithCgroupBestEffort.
+func (c *command) WithCgroup(cpuMax string, memMax int64) Command {
+	bestEffort := c.cgroup != nil && c.cgroup.bestEffort
+	c.cgroup = &cgroupLimits{cpuMax: cpuMax, memMax: memMax, bestEffort: bestEffort}
+	return c
+}
+
+// WithCgroupBestEffort makes the command run without cgroup limits when they can not be applied,
+// the failure is logged as a warning instead.
+func (c *command) WithCgroupBestEffort() Command {
+	if c.cgroup == nil {
+		c.cgroup = &cgroupLimits{}
+	}
+	c.cgroup.bestEffort = true
+	return c
+}
+
+func (l *cgroupLimits) controllers() []string {
+	var controllers []string
+	if l.cpuMax != "" {
+		controllers = append(controllers, "cpu")
+	}
+	if l.memMax > 0 {
+		controllers = append(controllers, "memory")
+	}
+	return controllers
+}
+
+func (l *cgroupLimits) validate() error {
+	if l.cpuMax != "" {
+		fields := strings.Fields(l.cpuMax)
+		if len(fields) == 0 || len(fields) > 2 {
+			return errors.Errorf("invalid cpu.max %q: should be $MAX [$PERIOD]", l.cpuMax)
+		}
+		if fields[0] != "max" {
+			if n, err := strconv.ParseUint(fields[0], 10, 64); err != nil || n == 0 {
+				return errors.Errorf("invalid cpu.max %q: max should be a positive number or max", l.cpuMax)
+			}
+		}
+		if len(fields) == 2 {
+			if n, err := strconv.ParseUint(fields[1], 10, 64); err != nil || n == 0 {
+				return errors.Errorf("invalid cpu.max %q: period should be a positive number", l.cpuMax)
+			}
+		}
+	}
+	if l.memMax < 0 {
+		return errors.Errorf("invalid memory.max %d: should not be negative", l.memMax)
+	}
+	return nil
+}
+
+// validateCgroup checks that the cgroup limits are valid and can be applied, unless they are best effort.
+func (c *command) validateCgroup() error {
+	if c.cgroup == nil {
+		return nil
+	}
+	if err := c.cgroup.validate(); err != nil {
+		return err
+	}
+	if c.cgroup.bestEffort {
+		return nil
+	}
+	if _, err := checkCgroup(c.cgroup.controllers()); err != nil {
+		return errors.Errorf("can not apply cgroup limits: %s", err)
+	}
+	return nil
+}
+
+// createCgroup creates the cgroup to run the command in, it returns nil if the command has no cgroup limits
+// or the limits are best effort and can not be applied.
+func (c *command) createCgroup(ctx context.Context) (*cgroup, error) {
+	if c.cgroup == nil {
+		return nil, nil
+	}
+	group, err := newCgroup(c.cgroup)
+	if err != nil {
+		if c.cgroup.bestEffort {
+			c.logger(ctx).Warnf("create cgroup of shell command failed, run without limits, command=%s, error=%s", c.String(), err)
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "create cgroup")
+	}
+	return group, nil
+}
+
+// wrapJoinCgroup wraps cmd by sh to move itself into the cgroup before it execs the command, so that the command
+// never runs outside the cgroup, not even for the moment between starting and joining. There is no way to start
+// a process in a cgroup by exec before go 1.20. The command run with a credential or in a root directory can not
+// write the cgroup, so it is not wrapped and only moved into the cgroup by joinCgroup after it starts.
+func (c *command) wrapJoinCgroup(group *cgroup, cmd *exec.Cmd) {
+	if group == nil || c.credential != nil || c.chroot != "" {
+		return
+	}
+	join := "echo $$ > " + QuoteArg(filepath.Join(group.dir, "cgroup.procs"))
+	if c.cgroup.bestEffort {
+		// the failure is logged by joinCgroup
+		join = "{ " + join + "; } 2>/dev/null;"
+	} else {
+		join += " &&"
+	}
+	// the program is already looked up, it is exec'ed by path regardless of the environment of the command
+	cmd.Args = append([]string{fallbackShell, "-c", join + ` exec "$@"`, "sh", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = fallbackShell
+}
+
+// joinCgroup moves the started process into the cgroup, it is a no-op for a process already joined by wrapJoinCgroup,
+// but still checks that the process is in the cgroup.
+func (c *command) joinCgroup(ctx context.Context, group *cgroup, pid int) error {
+	if group == nil {
+		return nil
+	}
+	if err := group.add(pid); err != nil {
+		if c.cgroup.bestEffort {
+			c.logger(ctx).Warnf("move shell command into cgroup failed, run without limits, command=%s, cgroup=%s, error=%s", c.String(), group.dir, err)
+			return nil
+		}
+		return errors.Wrapf(err, "move process into cgroup %s", group.dir)
+	}
+	return nil
+}
+
+// removeCgroup removes the cgroup after the command exits, processes left behind in it are killed.
+func (c *command) removeCgroup(ctx context.Context, group *cgroup) {
+	if group == nil {
+		return
+	}
+	if err := group.remove(); err != nil {
+		c.logger(ctx).Warnf("remove cgroup of shell command failed, command=%s, cgroup=%s, error=%s", c.String(), group.dir, err)
+	}
+}
@@ -0,0 +1,164 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	cgroupRemoveRetries = 50
+	cgroupRemoveBackoff = 10 * time.Millisecond
+)
+
+var cgroupSeq uint64
+
+// cgroup2Mount returns the mount point of the cgroup v2 hierarchy.
+func cgroup2Mount() (string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// the filesystem type follows the separator "-" after the optional fields
+		fields := strings.Fields(scanner.Text())
+		for i := 6; i+1 < len(fields); i++ {
+			if fields[i] == "-" {
+				if fields[i+1] == "cgroup2" {
+					return fields[4], nil
+				}
+				break
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("cgroup v2 is not mounted")
+}
+
+// checkCgroup checks that cgroup v2 is mounted with the controllers available, and returns its mount point.
+func checkCgroup(controllers []string) (string, error) {
+	mount, err := cgroup2Mount()
+	if err != nil {
+		return "", err
+	}
+	content, err := ioutil.ReadFile(filepath.Join(mount, "cgroup.controllers"))
+	if err != nil {
+		return "", err
+	}
+	available := strings.Fields(string(content))
+	for _, controller := range controllers {
+		found := false
+		for _, a := range available {
+			if a == controller {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", errors.Errorf("cgroup v2 controller %s is not available in %s", controller, mount)
+		}
+	}
+	return mount, nil
+}
+
+// newCgroup creates a transient cgroup with the limits.
+func newCgroup(limits *cgroupLimits) (*cgroup, error) {
+	controllers := limits.controllers()
+	mount, err := checkCgroup(controllers)
+	if err != nil {
+		return nil, err
+	}
+	if err := enableControllers(mount, controllers); err != nil {
+		return nil, err
+	}
+	parent := filepath.Join(mount, cgroupParent)
+	if err := os.Mkdir(parent, 0755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	if err := enableControllers(parent, controllers); err != nil {
+		return nil, err
+	}
+	group := &cgroup{dir: filepath.Join(parent, fmt.Sprintf("cmd-%d-%d", os.Getpid(), atomic.AddUint64(&cgroupSeq, 1)))}
+	if err := os.Mkdir(group.dir, 0755); err != nil {
+		return nil, err
+	}
+	if limits.cpuMax != "" {
+		err = writeCgroupFile(group.dir, "cpu.max", limits.cpuMax)
+	}
+	if err == nil && limits.memMax > 0 {
+		err = writeCgroupFile(group.dir, "memory.max", strconv.FormatInt(limits.memMax, 10))
+	}
+	if err != nil {
+		_ = group.remove()
+		return nil, err
+	}
+	return group, nil
+}
+
+func enableControllers(dir string, controllers []string) error {
+	for _, controller := range controllers {
+		if err := writeCgroupFile(dir, "cgroup.subtree_control", "+"+controller); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(value), 0644); err != nil {
+		return errors.Wrapf(err, "write %q to %s", value, path)
+	}
+	return nil
+}
+
+// add moves the process into the cgroup.
+func (g *cgroup) add(pid int) error {
+	return writeCgroupFile(g.dir, "cgroup.procs", strconv.Itoa(pid))
+}
+
+// remove removes the cgroup. A cgroup can not be removed while it has processes,
+// the processes left behind are killed by cgroup.kill if the kernel supports it.
+func (g *cgroup) remove() error {
+	var err error
+	for i := 0; i < cgroupRemoveRetries; i++ {
+		err = os.Remove(g.dir)
+		if err == nil || os.IsNotExist(err) {
+			return nil
+		}
+		if !errors.Is(err, syscall.EBUSY) {
+			return err
+		}
+		_ = writeCgroupFile(g.dir, "cgroup.kill", "1")
+		time.Sleep(cgroupRemoveBackoff)
+	}
+	return err
+}
@@ -0,0 +1,36 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+//go:build !linux
+// +build !linux
+
+package shell
+
+import "github.com/pkg/errors"
+
+var errCgroupUnsupported = errors.New("cgroup is only supported on linux")
+
+func checkCgroup(controllers []string) (string, error) {
+	return "", errCgroupUnsupported
+}
+
+func newCgroup(limits *cgroupLimits) (*cgroup, error) {
+	return nil, errCgroupUnsupported
+}
+
+func (g *cgroup) add(pid int) error {
+	return errCgroupUnsupported
+}
+
+func (g *cgroup) remove() error {
+	return nil
+}
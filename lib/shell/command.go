@@ -15,9 +15,20 @@ package shell
 import (
 	"context"
 	"fmt"
+	"hash"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/encoding"
+
 	"github.com/oceanbase/obagent/lib/mask"
+	agentlog "github.com/oceanbase/obagent/log"
 )
 
 type Program string
@@ -27,6 +38,10 @@ const (
 	Sh   Program = "sh"
 	Bash Program = "bash"
 	Zsh  Program = "zsh"
+	// shells of windows
+	Cmd        Program = "cmd"
+	PowerShell Program = "powershell"
+	Pwsh       Program = "pwsh"
 )
 
 const (
@@ -39,35 +54,128 @@ const (
 	AdminUser = "admin"
 )
 
+// DefaultProgram is the default shell program on unix, commands run by Cmd on windows by default.
 const DefaultProgram = Sh
 const DefaultOutputType = CombinedOutput
-const DefaultTimeout = 10 * time.Second
-const MaxTimeout = 30 * time.Minute // max half an hour
+const DefaultTimeout = 10 * time.Second // timeout of commands without one, see SetDefaultTimeout
+const MaxTimeout = 30 * time.Minute     // max half an hour
 const MinTimeout = 1 * time.Second
 
+// Command is a command to run, created by Shell and configured by the With builders.
+// It is not changed by running, so it can be built once and run any number of times, e.g. on a schedule,
+// or by several goroutines at the same time. The builders should not be called while it is running.
 type Command interface {
 	Execute() (*ExecuteResult, error)
 	ExecuteWithDebug() (*ExecuteResult, error)
 	ExecuteAllowFailure() (*ExecuteResult, error)
+	ExecuteContext(ctx context.Context) (*ExecuteResult, error)
+	ExecuteWithDebugContext(ctx context.Context) (*ExecuteResult, error)
+	ExecuteAllowFailureContext(ctx context.Context) (*ExecuteResult, error)
+	ExecuteStream(ctx context.Context) (<-chan string, <-chan error)
+	ExecuteForEachLine(ctx context.Context, fn func(line string) error) error
+	ExecuteWithRetry() (*ExecuteResult, error)
+	ExecuteJSON(v interface{}) (*ExecuteResult, error)
+	Start() (*Process, error)
+	StartDaemon(pidFile string) (int, error)
+	Validate() error
 	Cmd() string
 	User() string
 	Program() Program
 	OutputType() OutputType
 	Timeout() time.Duration
 	WithUser(user string) Command
+	WithUserFallback(users ...string) Command
 	WithProgram(program Program) Command
+	WithShell(program Program) Command
 	WithOutputType(outputType OutputType) Command
+	WithStderr() Command
 	WithTimeout(timeout time.Duration) Command
+	WithNoTimeout() Command
 	WithContext(ctx context.Context) Command
+	WithEnv(env map[string]string) Command
+	WithEnvSlice(env []string) Command
+	WithExpandEnv(vars map[string]string) Command
+	WithCleanEnv() Command
+	WithStdin(stdin io.Reader) Command
+	WithDir(dir string) Command
+	WithRetry(attempts int, backoff time.Duration) Command
+	WithExponentialBackoff() Command
+	WithRetryExitCodes(exitCodes ...int) Command
+	WithRetryHook(hook RetryHook) Command
+	WithMaxOutputBytes(n int) Command
+	WithMaxOutputLines(head, tail int) Command
+	WithMaxLineBytes(n int) Command
+	WithTimestampedOutput() Command
+	WithOutputHash(h hash.Hash) Command
+	WithKillGrace(grace time.Duration) Command
+	WithTimeoutSignal(sig syscall.Signal) Command
+	WithFailureOutputPattern(re *regexp.Regexp) Command
+	WithOutputRateLimit(bytesPerSec int) Command
+	WithOutputRateLimitKill(after time.Duration) Command
+	WithStripANSI() Command
+	WithIdleTimeout(idleTimeout time.Duration) Command
+	WithLogger(logger *log.Entry) Command
+	WithMetricName(name string) Command
+	WithOutputWriter(w io.Writer) Command
+	WithOutputMasking(enabled bool) Command
+	WithOutputEncoding(enc encoding.Encoding) Command
+	WithCredential(uid, gid uint32, groups []uint32) Command
+	WithChroot(dir string) Command
+	WithNice(priority int) Command
+	WithIONice(class, level int) Command
+	WithCgroup(cpuMax string, memMax int64) Command
+	WithCgroupBestEffort() Command
+	WithDryRun() Command
+	WithUmask(mask int) Command
+}
+
+// Credential is the uid, gid and supplementary groups to run a command with.
+type Credential struct {
+	Uid    uint32
+	Gid    uint32
+	Groups []uint32
 }
 
 type command struct {
-	user       string  // Run command as this user, if not provided, run command as current process's user
-	program    Program // shell program to execute command, e.g. sh, bash
-	outputType OutputType
-	cmd        string
-	timeout    time.Duration
-	context    context.Context
+	user            string   // Run command as this user, if not provided, run command as current process's user
+	fallbackUsers   []string // users to run command as the first existing one of, override user
+	program         Program  // shell program to execute command, e.g. sh, bash
+	outputType      OutputType
+	cmd             string
+	argv            []string      // program and args to run without a shell, cmd is their quoted form for display
+	script          bool          // cmd is the content of a script to run from a temp file
+	timeout         time.Duration // 0 means the default timeout
+	noTimeout       bool          // run the command without timeout, override timeout
+	context         context.Context
+	env             []string          // extra environment variables in the form of key=value, override the inherited ones
+	cleanEnv        bool              // do not inherit environment variables of current process
+	expandVars      map[string]string // variables to expand in cmd before running, see WithExpandEnv
+	stdin           io.Reader
+	dir             string // working directory of the command, if not provided, use current process's working directory
+	retry           retryPolicy
+	maxOutput       int               // max bytes of output to keep, 0 means unlimited
+	maxLines        lineLimit         // head and tail lines of output to keep, zero means unlimited
+	maxLineBytes    int               // max bytes of a line of ExecuteStream, 0 means defaultMaxLineBytes
+	timestamped     bool              // record the time of each line of output, see WithTimestampedOutput
+	outputHash      hash.Hash         // hash to feed the output to, see WithOutputHash
+	killGrace       time.Duration     // time to wait after SIGTERM before SIGKILL on timeout or cancellation
+	timeoutSignal   syscall.Signal    // signal to terminate with on timeout or cancellation instead of SIGTERM, 0 means default
+	failurePattern  *regexp.Regexp    // output matching it fails a command exiting with 0, see WithFailureOutputPattern
+	outputRate      outputRateLimit   // max rate of reading the output, zero means unlimited
+	stripANSI       bool              // whether to remove ANSI escape sequences from the output
+	idleTimeout     time.Duration     // max time without any output before the command is killed, 0 means unlimited
+	logEntry        *log.Entry        // logger of the command, if not provided, use the global logger
+	metricName      string            // name label of the command in metrics
+	outputWriter    io.Writer         // writer to write the output to instead of keeping it
+	keepStderr      bool              // keep stderr in the result for StdOutput, see WithStderr
+	noOutputMasking bool              // keep secrets in the output of the result, they are masked by default
+	outputEncoding  encoding.Encoding // encoding of the output to transcode to UTF-8, nil means UTF-8
+	credential      *Credential       // run command with the credential directly instead of switching user
+	chroot          string            // root directory of the command, paths of the command are relative to it
+	priority        schedPriority
+	cgroup          *cgroupLimits // resource limits of the cgroup to run the command in, nil means not limited
+	dryRun          bool          // resolve the command without running it
+	umask           *int          // umask of the command, nil means inheriting the one of the agent
 }
 
 func (c *command) Cmd() string {
@@ -86,8 +194,13 @@ func (c *command) OutputType() OutputType {
 	return c.outputType
 }
 
+// Timeout returns the timeout of the command, which is the default timeout if it is not set, see SetDefaultTimeout.
+// It is 0 if the command runs without timeout, see WithNoTimeout.
 func (c *command) Timeout() time.Duration {
-	return c.timeout
+	if c.noTimeout {
+		return 0
+	}
+	return timeoutOrDefault(c.timeout)
 }
 
 func (c *command) WithUser(user string) Command {
@@ -95,18 +208,73 @@ func (c *command) WithUser(user string) Command {
 	return c
 }
 
+// WithUserFallback makes the command run as the first existing one of users, e.g. admin on some hosts and ob on others.
+// The user is chosen right before the command starts, and is the User of the result.
+// It fails if none of users exists.
+func (c *command) WithUserFallback(users ...string) Command {
+	c.fallbackUsers = users
+	return c
+}
+
 func (c *command) WithProgram(program Program) Command {
 	c.program = program
 	return c
 }
 
+// WithShell sets the shell program to run the command, e.g. Bash. It is checked to be installed before running,
+// the command fails with a clear error if it is missing.
+func (c *command) WithShell(program Program) Command {
+	return c.WithProgram(program)
+}
+
+// WithCredential makes the command run with the uid, gid and supplementary groups directly,
+// instead of switching user by sudo or runuser. It takes precedence over the user of the command.
+// It requires the agent to run as root, and is not supported on windows.
+func (c *command) WithCredential(uid, gid uint32, groups []uint32) Command {
+	c.credential = &Credential{Uid: uid, Gid: gid, Groups: groups}
+	return c
+}
+
+// WithChroot makes the command run with dir as its root directory, confining it to the files under dir.
+// The program and working directory of the command are looked up inside dir.
+// It requires the agent to run as root, and is only supported on linux.
+func (c *command) WithChroot(dir string) Command {
+	c.chroot = dir
+	return c
+}
+
+// WithDryRun makes Execute and its variants validate and resolve the command without running it.
+// The result has the fully resolved command line as Command, including the runuser or sudo wrapper, and exit code 0.
+// A script is resolved with its content in place of the temp file it would run from.
+func (c *command) WithDryRun() Command {
+	c.dryRun = true
+	return c
+}
+
 func (c *command) WithOutputType(outputType OutputType) Command {
 	c.outputType = outputType
 	return c
 }
 
+// WithStderr keeps stderr in the Stderr of the result for StdOutput, where it is discarded by default.
+// Stderr is always kept for CombinedOutput.
+func (c *command) WithStderr() Command {
+	c.keepStderr = true
+	return c
+}
+
+// WithTimeout sets the timeout of the command, it is adapted between MinTimeout and MaxTimeout.
+// 0 means the default timeout, see SetDefaultTimeout. It panics if timeout is negative.
 func (c *command) WithTimeout(timeout time.Duration) Command {
-	c.timeout = adaptTimeout(timeout)
+	c.timeout = normalizeTimeout(timeout)
+	c.noTimeout = false
+	return c
+}
+
+// WithNoTimeout makes the command run until it exits or its context is done, without the default timeout or MaxTimeout.
+// Use it only for commands that are bounded otherwise, e.g. by a context or an idle timeout.
+func (c *command) WithNoTimeout() Command {
+	c.noTimeout = true
 	return c
 }
 
@@ -115,8 +283,244 @@ func (c *command) WithContext(ctx context.Context) Command {
 	return c
 }
 
+// WithEnv appends the given environment variables to the command's environment.
+// Variables with the same name as inherited ones override them.
+func (c *command) WithEnv(env map[string]string) Command {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		c.env = append(c.env, k+"="+env[k])
+	}
+	return c
+}
+
+// WithEnvSlice appends environment variables in the form of key=value to the command's environment.
+func (c *command) WithEnvSlice(env []string) Command {
+	c.env = append(c.env, env...)
+	return c
+}
+
+// WithExpandEnv makes $VAR and ${VAR} in the command replaced by the values of vars before running, like os.Expand,
+// independent of the environment of the agent and the command. Variables not in vars are kept for the shell to expand.
+// Values are substituted as is, use Template to quote values that may contain spaces or shell operators.
+// For commands with args, each arg is expanded.
+func (c *command) WithExpandEnv(vars map[string]string) Command {
+	c.expandVars = vars
+	return c
+}
+
+// expandEnv replaces the variables of vars in s, and keeps the others.
+func expandEnv(s string, vars map[string]string) string {
+	return os.Expand(s, func(name string) string {
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return "${" + name + "}"
+	})
+}
+
+// WithCleanEnv makes the command start from an empty environment instead of inheriting the current process's.
+// A command run as another user by runuser -l or sudo starts from the environment they reset to anyway.
+func (c *command) WithCleanEnv() Command {
+	c.cleanEnv = true
+	return c
+}
+
+// WithStdin feeds the data read from stdin to the command's standard input.
+// The reader is consumed by the first run, set a fresh one before running the command again.
+func (c *command) WithStdin(stdin io.Reader) Command {
+	c.stdin = stdin
+	return c
+}
+
+// WithDir sets the working directory of the command.
+func (c *command) WithDir(dir string) Command {
+	c.dir = dir
+	return c
+}
+
+// WithMaxOutputBytes keeps at most n bytes of the command's output, the rest is dropped
+// and the result is marked as truncated. n <= 0 means unlimited.
+func (c *command) WithMaxOutputBytes(n int) Command {
+	c.maxOutput = n
+	return c
+}
+
+// lineLimit is the number of the first and the last lines of output to keep.
+type lineLimit struct {
+	head int
+	tail int
+}
+
+// WithMaxOutputLines keeps the first head and the last tail lines of the command's output, the lines in between are
+// replaced by a marker like "...[100 lines omitted]", and the result is marked as truncated.
+// It applies to Output, Stdout and Stderr separately. Negative values are taken as 0, and 0 for both means unlimited.
+func (c *command) WithMaxOutputLines(head, tail int) Command {
+	if head < 0 {
+		head = 0
+	}
+	if tail < 0 {
+		tail = 0
+	}
+	c.maxLines = lineLimit{head: head, tail: tail}
+	return c
+}
+
+// defaultMaxLineBytes is the max bytes of a line of ExecuteStream by default.
+const defaultMaxLineBytes = 1024 * 1024
+
+// WithMaxLineBytes sets the max bytes of a line emitted by ExecuteStream and ExecuteForEachLine, 1 MiB by default.
+// A longer line fails the stream with an error wrapping bufio.ErrTooLong. n <= 0 means the default.
+func (c *command) WithMaxLineBytes(n int) Command {
+	c.maxLineBytes = n
+	return c
+}
+
+// WithOutputHash feeds the output of the command to h as it is produced, and keeps the digest in OutputHash of the result,
+// e.g. to verify a dump without a second pass over it. The output is stdout for StdOutput, or stdout and stderr otherwise,
+// as written by the command before truncation, including the output written to the writer of WithOutputWriter.
+// h is reset before each run, so the command should not run concurrently then.
+func (c *command) WithOutputHash(h hash.Hash) Command {
+	c.outputHash = h
+	return c
+}
+
+// WithKillGrace makes the command terminated gracefully on timeout or cancellation:
+// SIGTERM is sent to the process group first, and SIGKILL is sent only if it does not exit within grace.
+// Without a grace, the process group is killed by SIGKILL immediately.
+func (c *command) WithKillGrace(grace time.Duration) Command {
+	c.killGrace = grace
+	return c
+}
+
+// WithFailureOutputPattern makes a command exiting with 0 fail if its output matches re, e.g. ERROR: printed by
+// scripts exiting with 0 anyway. The output is matched after being transcoded, stripped and masked, and the first line
+// matching is kept in FailureLine of the result, which makes IsSuccessful false and Execute return an error.
+func (c *command) WithFailureOutputPattern(re *regexp.Regexp) Command {
+	c.failurePattern = re
+	return c
+}
+
+// WithTimeoutSignal makes the command terminated by sig on timeout or cancellation, e.g. SIGINT for tools cleaning up
+// on interruption. sig is sent to the process group instead of SIGTERM, and SIGKILL is sent if it does not exit within
+// the grace of WithKillGrace, or KillGrace without one. SIGKILL as sig kills the process group immediately.
+func (c *command) WithTimeoutSignal(sig syscall.Signal) Command {
+	c.timeoutSignal = sig
+	return c
+}
+
+// WithIdleTimeout makes the command killed with ErrIdleTimeout if it writes nothing to stdout and stderr for idleTimeout,
+// in addition to the total timeout.
+func (c *command) WithIdleTimeout(idleTimeout time.Duration) Command {
+	c.idleTimeout = idleTimeout
+	return c
+}
+
+// WithOutputWriter makes the output of the command written to w as it is produced instead of kept in memory,
+// so that a huge output does not exhaust the memory. The Output of the result is left empty.
+// Stderr is also written to w for CombinedOutput, and kept in the Stderr of the result for StdOutput with WithStderr.
+// An error writing to w stops copying the output and fails the command.
+func (c *command) WithOutputWriter(w io.Writer) Command {
+	c.outputWriter = w
+	return c
+}
+
+// WithOutputMasking sets whether secrets, e.g. passwords, in the output are masked in the result, it is enabled by default.
+// Disable it only if the output is not logged or returned, the output is masked in logs anyway.
+func (c *command) WithOutputMasking(enabled bool) Command {
+	c.noOutputMasking = !enabled
+	return c
+}
+
+// WithLogger makes the command log through logger instead of the global logger,
+// so that the logs carry the fields of the caller.
+func (c *command) WithLogger(logger *log.Entry) Command {
+	c.logEntry = logger
+	return c
+}
+
+// logger returns the logger of the command with ctx, which carries the command as structured fields of JSON logs.
+func (c *command) logger(ctx context.Context) *log.Entry {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = agentlog.WithContextFields(ctx, log.Fields{
+		"command": mask.MaskFromContext(ctx, c.cmd),
+		"user":    c.user,
+		"program": c.program,
+	})
+	if c.logEntry != nil {
+		return c.logEntry.WithContext(ctx)
+	}
+	return log.WithContext(ctx)
+}
+
+// runCopy returns a copy of the command for a single run, with the variables of WithExpandEnv expanded.
+// The command is resolved on the copy before starting, e.g. the fallback user is chosen, so that the command itself is not changed by running, and can be run again,
+// even concurrently. Each run builds its own exec.Cmd. A stdin is shared by the runs, use a fresh one for each run.
+func (c *command) runCopy() *command {
+	copied := *c
+	if c.expandVars != nil {
+		if c.argv != nil {
+			copied.argv = make([]string, 0, len(c.argv))
+			for _, arg := range c.argv {
+				copied.argv = append(copied.argv, expandEnv(arg, c.expandVars))
+			}
+			copied.cmd = QuoteArgs(copied.argv)
+		} else {
+			copied.cmd = expandEnv(c.cmd, c.expandVars)
+		}
+	}
+	return &copied
+}
+
+func (c *command) terminatePolicy() terminatePolicy {
+	policy := terminatePolicy{grace: c.killGrace, signal: c.timeoutSignal, logger: c.logger}
+	if policy.signal != 0 && policy.signal != syscall.SIGKILL && policy.grace <= 0 {
+		policy.grace = KillGrace
+	}
+	return policy
+}
+
 func (c *command) String() string {
-	return fmt.Sprintf("Command{user=%s, program=%s, outputType=%s, cmd=%s, timeout=%s}", c.user, c.program, c.outputType, mask.Mask(c.cmd), c.timeout)
+	return c.contextString(context.Background())
+}
+
+// contextString is like String, but keeps the command as is if masking is disabled by ctx, see mask.WithUnmasked.
+func (c *command) contextString(ctx context.Context) string {
+	return fmt.Sprintf("Command{user=%s, program=%s, outputType=%s, cmd=%s, timeout=%s}", c.user, c.program, c.outputType, mask.MaskFromContext(ctx, c.cmd), c.Timeout())
+}
+
+// defaultTimeout is the timeout in nanoseconds of commands and pipelines without one.
+var defaultTimeout = int64(DefaultTimeout)
+
+// SetDefaultTimeout sets the timeout of commands and pipelines without one, including the ones created before,
+// so that no command runs unbounded by mistake. It is DefaultTimeout by default, and is adapted between MinTimeout and MaxTimeout.
+func SetDefaultTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&defaultTimeout, int64(adaptTimeout(timeout)))
+}
+
+// timeoutOrDefault returns timeout, or the default timeout if timeout is not set.
+func timeoutOrDefault(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return time.Duration(atomic.LoadInt64(&defaultTimeout))
+	}
+	return timeout
+}
+
+// normalizeTimeout validates the timeout given to a builder, and adapts it between MinTimeout and MaxTimeout.
+// 0 is kept as is, which means the default timeout.
+func normalizeTimeout(timeout time.Duration) time.Duration {
+	if timeout < 0 {
+		panic(fmt.Sprintf("shell: invalid negative timeout %s", timeout))
+	}
+	if timeout == 0 {
+		return 0
+	}
+	return adaptTimeout(timeout)
 }
 
 // adaptTimeout between MinTimeout and MaxTimeout
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oceanbase/obagent/lib/mask"
+	agentlog "github.com/oceanbase/obagent/log"
+)
+
+// StartDaemon starts the command as a daemon detached from the agent, e.g. observer, writes its pid to pidFile,
+// and returns the pid without waiting for it. The daemon runs in a new session, so that it survives the agent
+// and is not killed together with the process group of the agent.
+// Its stdout and stderr are appended to the file of WithOutputWriter, which must be an *os.File, or discarded if not set.
+// It has no stdin. The timeout, idle timeout, context and cgroup of the command do not apply.
+func (c *command) StartDaemon(pidFile string) (int, error) {
+	c = c.runCopy()
+	ctx := context.WithValue(context.Background(), agentlog.StartTimeKey, time.Now())
+	c.logger(ctx).Infof("start shell command daemon, command=%s, pidFile=%s", c.String(), pidFile)
+	pid, err := c.startDaemon(ctx, pidFile)
+	if err != nil {
+		c.logger(ctx).Errorf("start shell command daemon error, command=%s, error=%s", c.String(), err)
+		return 0, errors.Wrapf(err, "error when start shell command daemon %s", mask.Mask(c.cmd))
+	}
+	c.logger(ctx).Infof("start shell command daemon end, command=%s, pid=%d", c.String(), pid)
+	return pid, nil
+}
+
+func (c *command) startDaemon(ctx context.Context, pidFile string) (int, error) {
+	if c.cgroup != nil {
+		return 0, errors.New("cgroup is not supported for daemons")
+	}
+	var output *os.File
+	if c.outputWriter == nil {
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			return 0, err
+		}
+		defer devNull.Close()
+		output = devNull
+	} else if file, ok := c.outputWriter.(*os.File); ok {
+		output = file
+	} else {
+		return 0, errors.Errorf("output of daemon must be a file, got %T", c.outputWriter)
+	}
+	if err := c.preflight(); err != nil {
+		return 0, err
+	}
+	run, removeScript, err := c.prepareScript()
+	if err != nil {
+		return 0, err
+	}
+	cmd := run.newExecCmd()
+	cmd.Stdin = nil
+	cmd.Stdout = output
+	cmd.Stderr = output
+	setDetached(cmd)
+	if err = cmd.Start(); err != nil {
+		removeScript()
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+	c.applyPriority(ctx, pid)
+	if err = writePidFile(pidFile, pid); err != nil {
+		// the daemon can not be tracked without the pid file
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		removeScript()
+		return 0, err
+	}
+	// reap the daemon if it exits before the agent, so that it does not stay as a zombie
+	go func() {
+		defer removeScript()
+		err := cmd.Wait()
+		c.logger(ctx).Infof("shell command daemon exited, command=%s, pid=%d, error=%v", c.String(), pid, err)
+	}()
+	return pid, nil
+}
+
+// writePidFile writes pid to a temp file and renames it to path, so that readers never see a partial pid.
+func writePidFile(path string, pid int) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return errors.Errorf("write pid file %s: %s", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.WriteString(strconv.Itoa(pid) + "\n"); err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return errors.Errorf("write pid file %s: %s", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+
+//go:build !windows
+// +build !windows
+
+package shell
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartDaemon(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "daemon.pid")
+	logFile, err := os.OpenFile(filepath.Join(dir, "daemon.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	defer logFile.Close()
+
+	pid, err := libShell.NewCommand("echo started; echo warn >&2; exec sleep 30").WithOutputWriter(logFile).StartDaemon(pidFile)
+	require.NoError(t, err)
+	defer syscall.Kill(pid, syscall.SIGKILL)
+
+	content, err := ioutil.ReadFile(pidFile)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(pid), strings.TrimSpace(string(content)))
+	assert.True(t, processAlive(pid))
+	// the daemon leads a new session and process group, detached from the agent
+	pgid, err := syscall.Getpgid(pid)
+	require.NoError(t, err)
+	assert.Equal(t, pid, pgid)
+
+	assert.Eventually(t, func() bool {
+		output, _ := ioutil.ReadFile(logFile.Name())
+		return string(output) == "started\nwarn\n"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = libShell.NewCommand("true").WithOutputWriter(&strings.Builder{}).StartDaemon(pidFile)
+	assert.Error(t, err)
+	_, err = libShell.NewCommand("true").StartDaemon(filepath.Join(dir, "not_exist", "daemon.pid"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"time"
+)
+
+// ExecuteDefaults are the options of commands run with a context, for the ones not set on the commands,
+// e.g. the timeout and the user of the commands run by an HTTP request.
+type ExecuteDefaults struct {
+	Timeout time.Duration // timeout of commands without one, 0 means the default timeout, see SetDefaultTimeout
+	User    string        // user to run commands without a user as, empty means current user
+}
+
+type executeDefaultsKey struct{}
+
+// WithExecuteDefaults returns a context carrying the defaults, which apply to the commands run with it
+// by ExecuteContext and its variants, ExecuteStream, or WithContext and Start.
+// Options set on a command, e.g. by WithTimeout, WithNoTimeout, WithUser or WithCredential, take precedence.
+func WithExecuteDefaults(ctx context.Context, defaults ExecuteDefaults) context.Context {
+	return context.WithValue(ctx, executeDefaultsKey{}, defaults)
+}
+
+// ExecuteDefaultsFromContext returns the defaults carried by ctx, and whether there are any.
+func ExecuteDefaultsFromContext(ctx context.Context) (ExecuteDefaults, bool) {
+	if ctx == nil {
+		return ExecuteDefaults{}, false
+	}
+	defaults, ok := ctx.Value(executeDefaultsKey{}).(ExecuteDefaults)
+	return defaults, ok
+}
+
+// applyDefaults sets the options of the command not set from the defaults carried by ctx, it is applied to a run copy.
+func (c *command) applyDefaults(ctx context.Context) {
+	defaults, ok := ExecuteDefaultsFromContext(ctx)
+	if !ok {
+		return
+	}
+	if c.timeout == 0 && !c.noTimeout && defaults.Timeout > 0 {
+		c.timeout = adaptTimeout(defaults.Timeout)
+	}
+	if c.user == "" && len(c.fallbackUsers) == 0 && c.credential == nil {
+		c.user = defaults.User
+	}
+}
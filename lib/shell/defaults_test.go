@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteDefaults(t *testing.T) {
+	ctx := WithExecuteDefaults(context.Background(), ExecuteDefaults{Timeout: MinTimeout, User: getCurrentUser()})
+	defaults, ok := ExecuteDefaultsFromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, MinTimeout, defaults.Timeout)
+	_, ok = ExecuteDefaultsFromContext(context.Background())
+	assert.False(t, ok)
+
+	result, err := libShell.NewCommand("sleep 10").ExecuteContext(ctx)
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	assert.Equal(t, getCurrentUser(), result.User)
+
+	// options of the command take precedence
+	_, err = libShell.NewCommand("sleep 1.5").WithTimeout(5 * time.Second).ExecuteContext(ctx)
+	require.NoError(t, err)
+	result, err = libShell.NewCommand("true").WithUser("").WithUserFallback(getCurrentUser()).ExecuteContext(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, getCurrentUser(), result.User)
+
+	// the command itself is not changed
+	cmd := libShell.NewCommand("true").WithContext(ctx)
+	_, err = cmd.Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "", cmd.User())
+	assert.Equal(t, DefaultTimeout, cmd.Timeout())
+}
@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import "golang.org/x/text/encoding"
+
+// WithOutputEncoding makes the captured output transcoded from enc to UTF-8, for tools emitting
+// output in the encoding of the host locale, e.g. GBK. The output is kept as is by default.
+// Output written to the writer set by WithOutputWriter is not transcoded.
+func (c *command) WithOutputEncoding(enc encoding.Encoding) Command {
+	c.outputEncoding = enc
+	return c
+}
+
+// decodeOutput transcodes s to UTF-8 from the output encoding, s is returned as is if it fails.
+func (c *command) decodeOutput(s string) string {
+	if c.outputEncoding == nil || s == "" {
+		return s
+	}
+	decoded, err := c.outputEncoding.NewDecoder().String(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
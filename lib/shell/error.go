@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import "errors"
+
+// ErrCommandTimeout is returned, possibly wrapped, when a command is killed because it runs out of its timeout.
+// Use errors.Is(err, ErrCommandTimeout) to tell a timeout from other failures.
+var ErrCommandTimeout = errors.New("Command timed out.")
+
+// TimeoutErr is the same as ErrCommandTimeout.
+//
+// Deprecated: use ErrCommandTimeout instead.
+var TimeoutErr = ErrCommandTimeout
+
+// ErrIdleTimeout is returned, possibly wrapped, when a command is killed because it produces no output for its idle timeout.
+var ErrIdleTimeout = errors.New("Command produced no output within idle timeout.")
+
+// ErrOutputRateExceeded is returned, wrapped, when a command is killed because its output keeps exceeding the rate limit
+// for too long, see WithOutputRateLimitKill.
+var ErrOutputRateExceeded = errors.New("Command output rate exceeded.")
+
+// ErrCommandNotAllowed is returned, wrapped, when a command is not allowed to run by SetAllowlist.
+var ErrCommandNotAllowed = errors.New("Command not allowed.")
+
+// ErrSudoPasswordRequired is returned, wrapped, when a command can not run as another user by sudo
+// because sudo requires a password, i.e. passwordless sudo is not configured for the agent.
+var ErrSudoPasswordRequired = errors.New("Sudo password required.")
+
+// ErrShuttingDown is returned, wrapped, when a command is not run because Shutdown is called.
+var ErrShuttingDown = errors.New("Shell is shutting down.")
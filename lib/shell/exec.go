@@ -15,9 +15,16 @@ package shell
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
@@ -33,20 +40,99 @@ const (
 )
 
 type ExecuteResult struct {
-	Command  string
-	ExitCode int
-	Output   string
+	Command     string
+	User        string   // user the command runs as, empty means current user
+	Argv        []string // args the process is spawned with, including the shell and the runuser or sudo wrapper, masked
+	Pid         int      // process id of the command, 0 if it is not started
+	ExitCode    int
+	Output      string // stdout for StdOutput, or stdout and stderr combined for CombinedOutput
+	Stdout      string
+	Stderr      string
+	Truncated   bool           // whether the output exceeds the max output bytes or lines and is truncated
+	StartedAt   time.Time      // time when the process is started
+	EndedAt     time.Time      // time when the process exits
+	Duration    time.Duration  // time cost of the process
+	Signaled    bool           // whether the process is terminated by a signal, e.g. OOM killed
+	Signal      syscall.Signal // the signal that terminated the process, valid if Signaled
+	Killed      bool           // whether the process is terminated by the agent on timeout, idle timeout or cancellation
+	Rusage      *Rusage        // resource usage of the process, nil if it is not started
+	TimedLines  []OutputLine   // lines of output with the time they are produced, only kept by WithTimestampedOutput
+	OutputHash  []byte         // digest of the output by the hash of WithOutputHash, nil without it
+	FailureLine string         // line of output matching the pattern of WithFailureOutputPattern, which fails the command
+	Throttled   time.Duration  // time reading the output is delayed by the rate limit of WithOutputRateLimit
+
+	rawOutput  string // output as written by the command, see Bytes
+	maskOnRead bool   // whether rawOutput is masked by Bytes, instead of already masked
+}
+
+// Bytes returns the output as written by the command, masked like Output, but not transcoded, stripped of ANSI
+// escape sequences or marked as truncated. Lines omitted by the max output lines are still marked.
+func (r ExecuteResult) Bytes() []byte {
+	if r.rawOutput == "" {
+		return []byte(r.Output)
+	}
+	if r.maskOnRead {
+		return []byte(mask.Mask(r.rawOutput))
+	}
+	return []byte(r.rawOutput)
 }
 
+// IsSuccessful reports whether the command exits with 0, and no line of its output matches the failure output pattern.
 func (r ExecuteResult) IsSuccessful() bool {
-	return r.ExitCode == 0
+	return r.ExitCode == 0 && r.FailureLine == ""
+}
+
+// exit codes of shells for a command that can not run, see https://tldp.org/LDP/abs/html/exitcodes.html
+const (
+	exitCodeNotExecutable = 126 // the command is found but can not be executed, e.g. permission denied
+	exitCodeNotFound      = 127 // the command is not found
+	exitCodeSignalBase    = 128 // 128+n means the command is killed by signal n
+	// cmd of windows exits with 9009 for a command not found
+	exitCodeNotFoundCmd = 9009
+)
+
+// IsNotFound reports whether the command, or the program run by the shell, is not found.
+// It is exit code 127 of sh compatible shells, 9009 of cmd, or an error spawning a program not found.
+func (r ExecuteResult) IsNotFound() bool {
+	switch r.ExitCode {
+	case exitCodeNotFound, exitCodeNotFoundCmd:
+		return true
+	case -1:
+		return r.Pid == 0 && (strings.Contains(r.Output, "no such file or directory") || strings.Contains(r.Output, "executable file not found"))
+	}
+	return false
+}
+
+// IsPermissionDenied reports whether the command, or the program run by the shell, can not be executed.
+// It is exit code 126 of sh compatible shells, or an error spawning a program without permission.
+func (r ExecuteResult) IsPermissionDenied() bool {
+	switch r.ExitCode {
+	case exitCodeNotExecutable:
+		return true
+	case -1:
+		return r.Pid == 0 && strings.Contains(r.Output, "permission denied")
+	}
+	return false
+}
+
+// WasKilled reports whether the command is terminated by a signal: the process itself, see Signaled, the agent
+// on timeout or cancellation, see Killed, or the program run by the shell, which the shell reports as exit code 128+n
+// for signal n, e.g. 137 for SIGKILL by the OOM killer. Signals are not reported on windows except by Killed.
+func (r ExecuteResult) WasKilled() bool {
+	return r.Signaled || r.Killed || (r.ExitCode > exitCodeSignalBase && r.ExitCode <= exitCodeSignalBase+64)
 }
 
 func (r ExecuteResult) AsError() error {
 	if r.IsSuccessful() {
 		return nil
 	}
-	return errors.Errorf("failed to execute command: %s, exitCode: %d, output: %s", r.Command, r.ExitCode, r.Output)
+	if r.Signaled {
+		return errors.Errorf("failed to execute command: %s, killed by signal %d, output: %s", r.Command, int(r.Signal), mask.Mask(r.Output))
+	}
+	if r.ExitCode == 0 {
+		return errors.Errorf("failed to execute command: %s, exitCode: 0 but output indicates failure: %s, output: %s", r.Command, mask.Mask(r.FailureLine), mask.Mask(r.Output))
+	}
+	return errors.Errorf("failed to execute command: %s, exitCode: %d, output: %s", r.Command, r.ExitCode, mask.Mask(r.Output))
 }
 
 func (r ExecuteResult) Lines() []string {
@@ -60,23 +146,124 @@ func (r ExecuteResult) Lines() []string {
 	return lines
 }
 
+// ForEachLine calls fn for each line of the output like Lines, without allocating all of them.
+// It stops and returns the error if fn returns one.
+func (r ExecuteResult) ForEachLine(fn func(line string) error) error {
+	if len(r.Output) == 0 {
+		return nil
+	}
+	if !strings.Contains(r.Output, "\n") {
+		return fn(r.Output)
+	}
+	rest := strings.Trim(r.Output, "\n")
+	for {
+		i := strings.IndexByte(rest, '\n')
+		if i < 0 {
+			return fn(rest)
+		}
+		if err := fn(rest[:i]); err != nil {
+			return err
+		}
+		rest = rest[i+1:]
+	}
+}
+
+// FirstLine returns the first non-empty line of the output with spaces trimmed, or "" if there is none.
+func (r ExecuteResult) FirstLine() string {
+	rest := r.Output
+	for rest != "" {
+		line := rest
+		if i := strings.IndexByte(rest, '\n'); i >= 0 {
+			line, rest = rest[:i], rest[i+1:]
+		} else {
+			rest = ""
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// LastLine returns the last non-empty line of the output with spaces trimmed, or "" if there is none,
+// e.g. the status printed at the end by a CLI tool.
+func (r ExecuteResult) LastLine() string {
+	rest := r.Output
+	for rest != "" {
+		line := rest
+		if i := strings.LastIndexByte(rest, '\n'); i >= 0 {
+			line, rest = rest[i+1:], rest[:i]
+		} else {
+			rest = ""
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// Grep returns the lines of the output, like Lines, that match the regular expression pattern.
+// It returns an error if the pattern is invalid.
+func (r ExecuteResult) Grep(pattern string) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Errorf("invalid grep pattern %q: %s", pattern, err)
+	}
+	return r.grep(re.MatchString), nil
+}
+
+// GrepFixed returns the lines of the output, like Lines, that contain substr.
+func (r ExecuteResult) GrepFixed(substr string) []string {
+	return r.grep(func(line string) bool {
+		return strings.Contains(line, substr)
+	})
+}
+
+func (r ExecuteResult) grep(match func(line string) bool) []string {
+	matched := []string{}
+	_ = r.ForEachLine(func(line string) error {
+		if match(line) {
+			matched = append(matched, line)
+		}
+		return nil
+	})
+	return matched
+}
+
 // Execute the given command and expect the command to succeed (exits with 0).
 // If the command exits with a non-zero code, return an error.
 func (c *command) Execute() (*ExecuteResult, error) {
-	executeResult, err := c.execute(info)
+	return c.ExecuteContext(c.context)
+}
+
+// Execute the given command, allow the command to failed (exits with non-zero code).
+func (c *command) ExecuteAllowFailure() (*ExecuteResult, error) {
+	return c.ExecuteAllowFailureContext(c.context)
+}
+
+func (c *command) ExecuteWithDebug() (*ExecuteResult, error) {
+	return c.ExecuteWithDebugContext(c.context)
+}
+
+// ExecuteContext is like Execute, but runs the command with ctx instead of the context of the command.
+// The process is killed when ctx is done.
+func (c *command) ExecuteContext(ctx context.Context) (*ExecuteResult, error) {
+	executeResult, err := c.execute(ctx, info)
 	if err != nil {
 		return executeResult, err
 	}
 	return executeResult, executeResult.AsError()
 }
 
-// Execute the given command, allow the command to failed (exits with non-zero code).
-func (c *command) ExecuteAllowFailure() (*ExecuteResult, error) {
-	return c.execute(info)
+// ExecuteAllowFailureContext is like ExecuteAllowFailure, but runs the command with ctx instead of the context of the command.
+func (c *command) ExecuteAllowFailureContext(ctx context.Context) (*ExecuteResult, error) {
+	return c.execute(ctx, info)
 }
 
-func (c *command) ExecuteWithDebug() (*ExecuteResult, error) {
-	executeResult, err := c.execute(debug)
+// ExecuteWithDebugContext is like ExecuteWithDebug, but runs the command with ctx instead of the context of the command.
+func (c *command) ExecuteWithDebugContext(ctx context.Context) (*ExecuteResult, error) {
+	executeResult, err := c.execute(ctx, debug)
 	if err != nil {
 		return executeResult, err
 	}
@@ -88,62 +275,376 @@ func (c *command) ExecuteWithDebug() (*ExecuteResult, error) {
 // 1. the exit code;
 // 2. the command output (stdout only, or stdout + stderr);
 // 3. the error;
-func (c *command) execute(flag int) (*ExecuteResult, error) {
-	if c.context == nil {
-		c.context = context.Background()
+// The result is not nil even if the command fails to start, its exit code is -1 and its output is the error then.
+// The command is run by the runner set by SetRunner if any.
+func (c *command) execute(parent context.Context, flag int) (*ExecuteResult, error) {
+	if runner := currentRunner(); runner != nil {
+		if parent == nil {
+			parent = context.Background()
+		}
+		return runner.Run(parent, c)
+	}
+	return c.spawn(parent, flag)
+}
+
+// spawn runs the command by spawning a process, see execute.
+func (c *command) spawn(parent context.Context, flag int) (executeResult *ExecuteResult, err error) {
+	c = c.runCopy()
+	defer func() {
+		c.observeMetrics(executeResult, err)
+	}()
+	if parent == nil {
+		parent = context.Background()
 	}
-	ctx := context.WithValue(c.context, agentlog.StartTimeKey, time.Now())
+	c.applyDefaults(parent)
+	ctx := context.WithValue(parent, agentlog.StartTimeKey, time.Now())
 	if flag&debug != 0 {
-		log.WithContext(ctx).Debugf("execute shell command start, command=%s", c.String())
+		c.logger(ctx).Debugf("execute shell command start, command=%s", c.String())
 	} else {
-		log.WithContext(ctx).Infof("execute shell command start, command=%s", c.String())
+		c.logger(ctx).Infof("execute shell command start, command=%s", c.String())
 	}
-	var command *exec.Cmd
-	currentUser := getCurrentUser()
-	if c.user == "" || c.user == currentUser {
-		command = exec.Command(string(c.program), "-c", c.cmd)
-	} else if currentUser == RootUser {
-		command = exec.Command("runuser", "-l", c.user, "-c", c.cmd)
-	} else if c.user == RootUser {
-		command = exec.Command("sudo", string(c.program), "-c", c.cmd)
-	} else {
-		command = exec.Command("sudo", "-u", c.user, string(c.program), "-c", c.cmd)
+	if err := c.preflight(); err != nil {
+		c.logger(ctx).Errorf("execute shell command error, command=%s, error=%s", c.String(), err)
+		return c.newErrorResult(err), errors.Wrapf(err, "error when execute shell command %s", mask.Mask(c.cmd))
 	}
-	var b []byte
-	var err error
-	if c.outputType == StdOutput {
-		b, err = CombinedOutputTimeout(command, c.timeout)
-	} else {
-		b, err = StdOutputTimeout(command, c.timeout)
+	if c.dryRun {
+		args := maskArgs(ctx, c.newExecCmd().Args)
+		resolved := QuoteArgs(args)
+		c.logger(ctx).Infof("execute shell command dry run, command=%s, resolved=%s", c.String(), resolved)
+		return &ExecuteResult{Command: resolved, User: c.user, Argv: args}, nil
+	}
+	run, removeScript, err := c.prepareScript()
+	if err != nil {
+		c.logger(ctx).Errorf("execute shell command error, command=%s, error=%s", c.String(), err)
+		return c.newErrorResult(err), errors.Errorf("error when execute shell command %s: %s", mask.Mask(c.cmd), err)
 	}
-	output := string(b)
-	log.WithContext(ctx).Debugf("execute shell command %s, output=%s", c.String(), output)
+	defer removeScript()
+	release, err := concurrencyLimiter.acquire(ctx)
 	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			exitCode := exitError.ExitCode()
-			log.WithContext(ctx).Infof("execute shell command failed, command=%s, exitCode=%d", c.String(), exitCode)
-			return &ExecuteResult{
-				Command:  c.String(),
-				ExitCode: exitCode,
-				Output:   output,
-			}, nil
+		c.logger(ctx).Errorf("execute shell command cancelled while waiting for a slot, command=%s, error=%s", c.String(), err)
+		return c.newErrorResult(err), errors.Wrapf(err, "shell command %s cancelled while waiting for a slot", mask.Mask(c.cmd))
+	}
+	defer release()
+	command := run.newExecCmd()
+	capture := c.newOutputCapture()
+	if isSudo(command) {
+		// stderr is checked for ErrSudoPasswordRequired, even if it is not kept in the result
+		capture.dropStderr = false
+	}
+	if c.idleTimeout > 0 {
+		capture.idle = newIdleWatch(c.idleTimeout, capture.abort)
+		defer capture.idle.stop()
+	}
+	command.Stdout = capture.stdoutWriter()
+	command.Stderr = capture.stderrWriter()
+	startedAt := time.Now()
+	releaseProcess, err := c.startProcess(ctx, command)
+	if err == nil {
+		untrack := concurrencyLimiter.track(command.Process, capture.stopThrottle)
+		err = waitCommand(ctx, command, c.Timeout(), capture.abort, capture.terminatePolicy(c.terminatePolicy()))
+		untrack()
+	}
+	releaseProcess()
+	return c.newExecuteResult(ctx, flag, capture, command, startedAt, err)
+}
+
+// maskArgs masks each arg separately, so that masking does not break the quoting of them.
+func maskArgs(ctx context.Context, args []string) []string {
+	masked := make([]string, 0, len(args))
+	for _, arg := range args {
+		masked = append(masked, mask.MaskFromContext(ctx, arg))
+	}
+	return masked
+}
+
+// newExecuteResult builds the result of the finished command from its output, state and the error of waiting for it.
+func (c *command) newExecuteResult(ctx context.Context, flag int, capture *outputCapture, cmd *exec.Cmd, startedAt time.Time, err error) (*ExecuteResult, error) {
+	endedAt := time.Now()
+	state := cmd.ProcessState
+	rawOutput, truncated := capture.rawOutput(c.outputType)
+	stdout, stderr := capture.streams()
+	masking := !c.noOutputMasking && !mask.IsUnmasked(ctx)
+	transformed := c.outputEncoding != nil || c.stripANSI
+	maskOnRead := false
+	if masking {
+		if transformed {
+			// the raw output is masked only if Bytes is called, masking rules may not match before transcoding
+			maskOnRead = true
 		} else {
-			log.WithContext(ctx).Errorf("execute shell command error, command=%s, error=%s", c.String(), err)
-			return nil, errors.Errorf("error when execute shell command %s: %s", mask.Mask(c.cmd), err)
+			// bytes not matched by the masking rules are kept as is, even if they are not valid UTF-8
+			rawOutput = mask.Mask(rawOutput)
+		}
+	}
+	output := rawOutput
+	if truncated {
+		output += truncatedMarker
+	}
+	if c.outputEncoding != nil {
+		output, stdout, stderr = c.decodeOutput(output), c.decodeOutput(stdout), c.decodeOutput(stderr)
+	}
+	if c.stripANSI {
+		output, stdout, stderr = StripANSI(output), StripANSI(stdout), StripANSI(stderr)
+	}
+	if masking {
+		if transformed {
+			output = mask.Mask(output)
+		}
+		stdout, stderr = mask.Mask(stdout), mask.Mask(stderr)
+	}
+	// the output is always masked in logs, even if it is kept as is in the result, unless ctx is of a debug session
+	c.logger(ctx).Debugf("execute shell command %s, stdout=%s", c.contextString(ctx), mask.MaskFromContext(ctx, stdout))
+	if stderr != "" {
+		c.logger(ctx).Debugf("execute shell command %s, stderr=%s", c.contextString(ctx), mask.MaskFromContext(ctx, stderr))
+	}
+	resultStderr := stderr
+	if c.outputType == StdOutput && !c.keepStderr {
+		resultStderr = ""
+	}
+	executeResult := &ExecuteResult{
+		Command:    c.String(),
+		User:       c.user,
+		Argv:       maskArgs(ctx, cmd.Args),
+		Output:     output,
+		Stdout:     stdout,
+		Stderr:     resultStderr,
+		Truncated:  capture.truncated(),
+		StartedAt:  startedAt,
+		EndedAt:    endedAt,
+		Duration:   endedAt.Sub(startedAt),
+		TimedLines: c.timedLines(ctx, capture, startedAt, endedAt),
+		OutputHash: capture.digest(),
+		Throttled:  capture.throttled(),
+		rawOutput:  rawOutput,
+		maskOnRead: maskOnRead,
+	}
+	if state != nil {
+		executeResult.Pid = state.Pid()
+		executeResult.Rusage = newRusage(state)
+		if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			executeResult.Signaled = true
+			executeResult.Signal = status.Signal()
+		}
+	}
+	if err == nil {
+		if c.failurePattern != nil {
+			executeResult.FailureLine = matchedLine(c.failurePattern, output)
+			if executeResult.FailureLine != "" {
+				c.logger(ctx).Infof("execute shell command failed, command=%s, failure output=%s", c.String(), mask.Mask(executeResult.FailureLine))
+				return executeResult, nil
+			}
 		}
-	} else {
 		if flag&debug != 0 {
-			log.WithContext(ctx).Debugf("execute shell command end, command=%s", c.String())
+			c.logger(ctx).Debugf("execute shell command end, command=%s", c.String())
+		} else {
+			c.logger(ctx).Infof("execute shell command end, command=%s", c.String())
+		}
+		return executeResult, nil
+	}
+	if exitError, ok := err.(*exec.ExitError); ok {
+		executeResult.ExitCode = exitError.ExitCode()
+		if isSudoPasswordRequired(cmd, executeResult.ExitCode, stderr) {
+			c.logger(ctx).Errorf("execute shell command failed, command=%s, error=%s", c.String(), ErrSudoPasswordRequired)
+			return executeResult, errors.Wrapf(ErrSudoPasswordRequired, "can not run shell command %s as user %s", mask.Mask(c.cmd), c.user)
+		}
+		if executeResult.Signaled {
+			c.logger(ctx).Infof("execute shell command failed, command=%s, signal=%d", c.String(), int(executeResult.Signal))
+		} else {
+			c.logger(ctx).Infof("execute shell command failed, command=%s, exitCode=%d", c.String(), executeResult.ExitCode)
+		}
+		return executeResult, nil
+	}
+	// the process is killed or not started, there is no exit code
+	executeResult.ExitCode = -1
+	executeResult.Killed = state != nil && (errors.Is(err, ErrCommandTimeout) || errors.Is(err, ErrIdleTimeout) || errors.Is(err, ErrOutputRateExceeded) || err == ctx.Err())
+	if errors.Is(err, ErrCommandTimeout) {
+		// keep the output collected before the process got killed, it helps to find where the command hangs
+		c.logger(ctx).Errorf("execute shell command timeout, command=%s, timeout=%s", c.String(), c.Timeout())
+		return executeResult, errors.Wrapf(err, "shell command %s timed out after %s", mask.Mask(c.cmd), c.Timeout())
+	}
+	if errors.Is(err, ErrIdleTimeout) {
+		c.logger(ctx).Errorf("execute shell command idle timeout, command=%s, idleTimeout=%s", c.String(), c.idleTimeout)
+		return executeResult, errors.Wrapf(err, "shell command %s produced no output for %s", mask.Mask(c.cmd), c.idleTimeout)
+	}
+	if errors.Is(err, ErrOutputRateExceeded) {
+		c.logger(ctx).Errorf("execute shell command output rate exceeded, command=%s, rateLimit=%d, killAfter=%s", c.String(), c.outputRate.bytesPerSec, c.outputRate.killAfter)
+		return executeResult, errors.Wrapf(err, "shell command %s produced output faster than %d bytes/s for %s", mask.Mask(c.cmd), c.outputRate.bytesPerSec, c.outputRate.killAfter)
+	}
+	if err == ctx.Err() {
+		c.logger(ctx).Errorf("execute shell command cancelled, command=%s, error=%s", c.String(), err)
+		return executeResult, errors.Wrapf(err, "shell command %s cancelled", mask.Mask(c.cmd))
+	}
+	c.logger(ctx).Errorf("execute shell command error, command=%s, error=%s", c.String(), err)
+	if state == nil {
+		// the process is not started, e.g. the program is not found
+		executeResult.Output = mask.Mask(err.Error())
+	}
+	return executeResult, errors.Errorf("error when execute shell command %s: %s", mask.Mask(c.cmd), err)
+}
+
+// matchedLine returns the line of output where pattern matches first without the line ending, or "" if none matches.
+// A match of an empty line is returned as "(empty line)".
+func matchedLine(pattern *regexp.Regexp, output string) string {
+	loc := pattern.FindStringIndex(output)
+	if loc == nil {
+		return ""
+	}
+	start := strings.LastIndexByte(output[:loc[0]], '\n') + 1
+	end := len(output)
+	if i := strings.IndexByte(output[loc[0]:], '\n'); i >= 0 {
+		end = loc[0] + i
+	}
+	line := strings.TrimSuffix(output[start:end], "\r")
+	if line == "" {
+		return "(empty line)"
+	}
+	return line
+}
+
+// sudoPasswordPrompts are the messages of sudo -n failing for a password, "a terminal is required" for old versions.
+var sudoPasswordPrompts = []string{"sudo: a password is required", "sudo: a terminal is required"}
+
+// isSudoPasswordRequired reports whether the command is sudo failed for a password.
+func isSudoPasswordRequired(cmd *exec.Cmd, exitCode int, stderr string) bool {
+	if !isSudo(cmd) || exitCode != 1 {
+		return false
+	}
+	for _, prompt := range sudoPasswordPrompts {
+		if strings.Contains(stderr, prompt) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSudo reports whether the command is wrapped with sudo to run as another user.
+func isSudo(cmd *exec.Cmd) bool {
+	return len(cmd.Args) > 0 && cmd.Args[0] == "sudo"
+}
+
+// newErrorResult returns the result of the command failed before starting with err.
+// Its exit code is -1, and its output is the error.
+func (c *command) newErrorResult(err error) *ExecuteResult {
+	return &ExecuteResult{
+		Command:  c.String(),
+		User:     c.user,
+		ExitCode: -1,
+		Output:   mask.Mask(err.Error()),
+	}
+}
+
+// newExecCmd builds the exec.Cmd to run the command, wrapping it with runuser or sudo
+// when the command should run as a user other than the current one.
+// sudo runs with -n, so that it fails at once instead of waiting for a password, see ErrSudoPasswordRequired.
+// runuser -l and sudo reset the environment, so the variables of WithEnv are passed to the command through them,
+// exported by the script of runuser, or as VAR=value args of sudo, which requires SETENV in sudoers.
+func (c *command) newExecCmd() *exec.Cmd {
+	c = c.withUmaskApplied()
+	var cmd *exec.Cmd
+	currentUser := getCurrentUser()
+	if c.credential != nil {
+		// the credential is applied by the kernel, there is no need to switch user
+		if c.argv != nil {
+			cmd = exec.Command(c.argv[0], c.argv[1:]...)
 		} else {
-			log.WithContext(ctx).Infof("execute shell command end, command=%s", c.String())
+			cmd = exec.Command(string(c.program), c.program.commandArgs(c.cmd)...)
+		}
+		setCredential(cmd, c.credential)
+	} else if c.argv != nil {
+		cmd = c.newArgsExecCmd(currentUser)
+	} else if c.user == "" || c.user == currentUser || !userSwitchSupported {
+		cmd = exec.Command(string(c.program), c.program.commandArgs(c.cmd)...)
+	} else if currentUser == RootUser {
+		// the login shell of runuser starts in the user's home, so change to the working directory explicitly,
+		// and exit if it fails, as the script may be a list of commands, e.g. with the umask applied
+		script := exportEnv(c.env) + c.cmd
+		if c.dir != "" {
+			script = "cd " + QuoteArg(c.dir) + " || exit 1; " + script
+		}
+		cmd = exec.Command("runuser", "-l", c.user, "-c", script)
+	} else {
+		args := append(c.sudoArgs(), string(c.program))
+		cmd = exec.Command("sudo", append(args, c.program.commandArgs(c.cmd)...)...)
+	}
+	if c.cleanEnv || len(c.env) > 0 {
+		// a nil Env means inheriting, so a clean environment must be an empty slice
+		env := []string{}
+		if !c.cleanEnv {
+			env = os.Environ()
 		}
-		return &ExecuteResult{
-			ExitCode: 0,
-			Output:   output,
-		}, nil
+		// later values override earlier ones with the same key
+		cmd.Env = append(env, c.env...)
+	}
+	cmd.Stdin = c.stdin
+	cmd.Dir = c.dir
+	if c.chroot != "" {
+		setChroot(cmd, c.chroot)
+	}
+	return cmd
+}
+
+// newArgsExecCmd builds the exec.Cmd to run argv without a shell, runuser and sudo also exec argv directly.
+func (c *command) newArgsExecCmd(currentUser string) *exec.Cmd {
+	if c.user == "" || c.user == currentUser || !userSwitchSupported {
+		return exec.Command(c.argv[0], c.argv[1:]...)
+	} else if currentUser == RootUser {
+		return exec.Command("runuser", append([]string{"-u", c.user, "--"}, c.argv...)...)
+	} else {
+		return exec.Command("sudo", append(append(c.sudoArgs(), "--"), c.argv...)...)
 	}
 }
 
+// sudoArgs returns the args of sudo before the command to run as the user, with the environment variables of the command.
+func (c *command) sudoArgs() []string {
+	args := []string{"-n"}
+	if c.user != RootUser {
+		args = append(args, "-u", c.user)
+	}
+	return append(args, c.env...)
+}
+
+// exportEnv returns the shell commands to export the environment variables in the form of key=value.
+func exportEnv(env []string) string {
+	var s strings.Builder
+	for _, kv := range env {
+		kv := strings.SplitN(kv, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		s.WriteString("export " + kv[0] + "=" + QuoteArg(kv[1]) + "; ")
+	}
+	return s.String()
+}
+
+// validateDir checks the working directory before starting the command, so that a bad directory
+// gets a descriptive error instead of an opaque fork/exec failure.
+func (c *command) validateDir() error {
+	if c.dir == "" {
+		return nil
+	}
+	// the working directory is inside the root directory of the command
+	info, err := os.Stat(filepath.Join(c.chroot, c.dir))
+	if err != nil {
+		return errors.Errorf("invalid working directory %s: %s", c.dir, err)
+	}
+	if !info.IsDir() {
+		return errors.Errorf("invalid working directory %s: not a directory", c.dir)
+	}
+	if c.user == "" || c.user == getCurrentUser() || c.credential != nil {
+		return nil
+	}
+	check := &command{
+		user:    c.user,
+		program: c.program,
+		cmd:     fmt.Sprintf("test -x %s", QuoteArg(c.dir)),
+		timeout: DefaultTimeout,
+		chroot:  c.chroot,
+	}
+	if err = RunTimeout(check.newExecCmd(), check.timeout); err != nil {
+		return errors.Errorf("invalid working directory %s: not accessible by user %s: %s", c.dir, c.user, err)
+	}
+	return nil
+}
+
 // CombinedOutputTimeout runs the given command with the given timeout and
 // returns the combined output of stdout and stderr.
 // If the command times out, it attempts to kill the process.
@@ -151,7 +652,7 @@ func CombinedOutputTimeout(c *exec.Cmd, timeout time.Duration) ([]byte, error) {
 	var b bytes.Buffer
 	c.Stdout = &b
 	c.Stderr = &b
-	if err := c.Start(); err != nil {
+	if err := startCmd(c); err != nil {
 		return nil, err
 	}
 	err := WaitTimeout(c, timeout)
@@ -165,26 +666,151 @@ func StdOutputTimeout(c *exec.Cmd, timeout time.Duration) ([]byte, error) {
 	var b bytes.Buffer
 	c.Stdout = &b
 	c.Stderr = nil
-	if err := c.Start(); err != nil {
+	if err := startCmd(c); err != nil {
 		return nil, err
 	}
 	err := WaitTimeout(c, timeout)
 	return b.Bytes(), err
 }
 
+// SeparateOutputTimeout runs the given command with the given timeout and
+// returns the output of stdout and stderr separately.
+// Both of them are read through pipes concurrently, so that a command writing a lot to one of them
+// never blocks on a full pipe while the other one is waited for.
+// If the command times out, it attempts to kill the process.
+func SeparateOutputTimeout(c *exec.Cmd, timeout time.Duration) ([]byte, []byte, error) {
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	stderrReader, stderrWriter, err := os.Pipe()
+	if err != nil {
+		_ = stdoutReader.Close()
+		_ = stdoutWriter.Close()
+		return nil, nil, err
+	}
+	c.Stdout = stdoutWriter
+	c.Stderr = stderrWriter
+	err = startCmd(c)
+	// the process holds the write ends now, close ours so that reading ends when the process exits
+	_ = stdoutWriter.Close()
+	_ = stderrWriter.Close()
+	if err != nil {
+		_ = stdoutReader.Close()
+		_ = stderrReader.Close()
+		return nil, nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	var wg sync.WaitGroup
+	readAll := func(buf *bytes.Buffer, r *os.File) {
+		defer wg.Done()
+		defer r.Close()
+		_, _ = io.Copy(buf, r)
+	}
+	wg.Add(2)
+	go readAll(&stdout, stdoutReader)
+	go readAll(&stderr, stderrReader)
+	err = WaitTimeout(c, timeout)
+	// the pipes are closed by the process group exiting or getting killed
+	wg.Wait()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
 // RunTimeout runs the given command with the given timeout.
 // If the command times out, it attempts to kill the process.
 func RunTimeout(c *exec.Cmd, timeout time.Duration) error {
-	if err := c.Start(); err != nil {
+	if err := startCmd(c); err != nil {
 		return err
 	}
 	return WaitTimeout(c, timeout)
 }
 
+// startProcess starts the command and applies the settings that can only be applied to a started process,
+// and registers it as active, see ActiveCommands.
+// The returned release func cleans up the resources of the process after it exits, it is never nil.
+func (c *command) startProcess(ctx context.Context, cmd *exec.Cmd) (release func(), err error) {
+	group, err := c.createCgroup(ctx)
+	if err != nil {
+		return func() {}, err
+	}
+	c.wrapJoinCgroup(group, cmd)
+	if err := startCmd(cmd); err != nil {
+		c.removeCgroup(ctx, group)
+		return func() {}, err
+	}
+	if err := c.joinCgroup(ctx, group, cmd.Process.Pid); err != nil {
+		_ = signalProcessGroup(cmd.Process, syscall.SIGKILL)
+		_ = cmd.Wait()
+		c.removeCgroup(ctx, group)
+		return func() {}, err
+	}
+	c.applyPriority(ctx, cmd.Process.Pid)
+	unregister := c.registerActive(ctx, cmd.Process.Pid)
+	return func() {
+		unregister()
+		c.removeCgroup(ctx, group)
+	}, nil
+}
+
+// startCmd starts the given command in a new process group. A Stdin that is not a file is copied into the process by
+// our own goroutine instead of the one of exec.Cmd, so that Wait does not block on a half-written
+// pipe when the process is killed: Wait closes the pipe and the copy goroutine then terminates.
+func startCmd(c *exec.Cmd) error {
+	setProcessGroup(c)
+	stdin := c.Stdin
+	if stdin == nil {
+		return c.Start()
+	}
+	if _, ok := stdin.(*os.File); ok {
+		return c.Start()
+	}
+	c.Stdin = nil
+	w, err := c.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err = c.Start(); err != nil {
+		return err
+	}
+	go func() {
+		if _, err := io.Copy(w, stdin); err != nil {
+			log.Debugf("write stdin of command %s stopped: %s", mask.Mask(c.String()), err)
+		}
+		_ = w.Close()
+	}()
+	return nil
+}
+
+var (
+	currentUserOnce sync.Once
+	currentUserName string
+)
+
+// getCurrentUser returns the name of the user running the agent. It is looked up only once,
+// as the user of the process does not change.
 func getCurrentUser() string {
+	currentUserOnce.Do(func() {
+		currentUserName = lookupCurrentUser()
+	})
+	return currentUserName
+}
+
+// lookupCurrentUser looks up the current user, falls back to root for uid 0 or the USER environment variable,
+// e.g. in a static binary without the user database.
+func lookupCurrentUser() string {
 	currentUser, err := user.Current()
-	if err != nil {
-		return ""
+	if err == nil {
+		return currentUser.Username
+	}
+	if os.Geteuid() == 0 {
+		log.Warnf("get current user failed, use %s for uid 0: %s", RootUser, err)
+		return RootUser
+	}
+	if name := os.Getenv("USER"); name != "" {
+		log.Warnf("get current user failed, use %s from environment variable USER: %s", name, err)
+		return name
 	}
-	return currentUser.Username
+	log.Warnf("get current user failed, commands may not run as the expected user: %s", err)
+	return ""
 }
@@ -14,14 +14,29 @@ package shell
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	log "github.com/sirupsen/logrus"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/simplifiedchinese"
 )
 
 var (
@@ -156,3 +171,639 @@ func TestRunError(t *testing.T) {
 
 	assert.Error(t, err)
 }
+
+func TestExecuteWithEnv(t *testing.T) {
+	os.Setenv("SHELL_TEST_INHERITED", "inherited")
+	defer os.Unsetenv("SHELL_TEST_INHERITED")
+
+	result, err := libShell.NewCommand("echo $SHELL_TEST_INHERITED-$OB_HOME").
+		WithEnv(map[string]string{"OB_HOME": "/home/admin/oceanbase"}).
+		Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "inherited-/home/admin/oceanbase\n", result.Output)
+
+	result, err = libShell.NewCommand("echo $SHELL_TEST_INHERITED-$OB_HOME").
+		WithCleanEnv().
+		WithEnvSlice([]string{"OB_HOME=/a", "OB_HOME=/b"}).
+		Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "-/b\n", result.Output)
+}
+
+func TestExecuteWithStdin(t *testing.T) {
+	input := "line 1\nline 2\nline 3\n"
+	result, err := libShell.NewCommand("cat").WithStdin(strings.NewReader(input)).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, input, result.Output)
+	assert.Equal(t, []string{"line 1", "line 2", "line 3"}, result.Lines())
+}
+
+// the stdin reader never ends, the command should still time out and return
+func TestRunTimeoutWithBlockingStdin(t *testing.T) {
+	if sleepbin == "" {
+		t.Skip("'sleep' binary not available on OS, skipping.")
+	}
+	r, w := io.Pipe()
+	defer w.Close()
+	cmd := exec.Command(sleepbin, "10")
+	cmd.Stdin = r
+	err := RunTimeout(cmd, time.Millisecond*20)
+	assert.Equal(t, TimeoutErr, err)
+}
+
+func TestExecuteWithDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "script.sh"), []byte("echo from script"), 0644))
+
+	result, err := libShell.NewCommand("sh ./script.sh").WithDir(dir).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "from script\n", result.Output)
+
+	_, err = libShell.NewCommand("pwd").WithDir(filepath.Join(dir, "not_exist")).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid working directory")
+
+	_, err = libShell.NewCommand("pwd").WithDir(filepath.Join(dir, "script.sh")).Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not a directory")
+}
+
+func TestExecuteSeparateOutput(t *testing.T) {
+	cmd := "echo out1; echo err1 >&2; echo out2"
+	result, err := libShell.NewCommand(cmd).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "out1\nout2\n", result.Stdout)
+	assert.Equal(t, "err1\n", result.Stderr)
+	// stdout and stderr are read from separate pipes, so only the content of the combined output is stable
+	assert.ElementsMatch(t, []string{"out1", "err1", "out2"}, result.Lines())
+
+	// stderr is discarded for StdOutput unless it is asked for
+	result, err = libShell.NewCommand(cmd).WithOutputType(StdOutput).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "out1\nout2\n", result.Output)
+	assert.Empty(t, result.Stderr)
+
+	result, err = libShell.NewCommand(cmd).WithOutputType(StdOutput).WithStderr().Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "out1\nout2\n", result.Output)
+	assert.Equal(t, "err1\n", result.Stderr)
+}
+
+func TestSeparateOutputLarge(t *testing.T) {
+	// more than the pipe buffer of 64KB to both streams, stderr first, which blocks if stdout is read first
+	const size = 200 * 1024
+	script := fmt.Sprintf("head -c %d /dev/zero | tr '\\0' e >&2; head -c %d /dev/zero | tr '\\0' o", size, size)
+	stdout, stderr, err := SeparateOutputTimeout(exec.Command("sh", "-c", script), 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("o", size), string(stdout))
+	assert.Equal(t, strings.Repeat("e", size), string(stderr))
+
+	result, err := libShell.NewCommand(script).WithOutputType(StdOutput).WithStderr().Execute()
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("o", size), result.Stdout)
+	assert.Equal(t, strings.Repeat("e", size), result.Stderr)
+
+	_, _, err = SeparateOutputTimeout(exec.Command("sleep", "10"), 20*time.Millisecond)
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+}
+
+func TestExecuteTimeoutPartialOutput(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test due to long running.")
+	}
+	result, err := libShell.NewCommand("echo started; sleep 10").WithTimeout(time.Second).Execute()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	require.NotNil(t, result)
+	assert.False(t, result.IsSuccessful())
+	assert.Equal(t, "started\n", result.Output)
+}
+
+func TestErrCommandTimeout(t *testing.T) {
+	err := RunTimeout(exec.Command("sleep", "10"), 20*time.Millisecond)
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	_, err = CombinedOutputTimeout(exec.Command("sleep", "10"), 20*time.Millisecond)
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	_, err = StdOutputTimeout(exec.Command("sleep", "10"), 20*time.Millisecond)
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+
+	// a spawn error is not a timeout
+	_, err = StdOutputTimeout(exec.Command("/not/exist/command"), time.Second)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrCommandTimeout))
+
+	_, err = libShell.NewCommand("sleep 10").WithTimeout(20 * time.Millisecond).Execute()
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	assert.True(t, errors.Is(err, TimeoutErr))
+}
+
+func TestExecuteResultKilled(t *testing.T) {
+	result, err := libShell.NewCommand("sleep 10").WithTimeout(MinTimeout).Execute()
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	require.NotNil(t, result)
+	assert.True(t, result.Killed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	result, err = libShell.NewCommand("sleep 10").ExecuteContext(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.True(t, result.Killed)
+
+	result, err = libShell.NewCommand("exit 3").ExecuteAllowFailure()
+	require.NoError(t, err)
+	assert.False(t, result.Killed)
+
+	// the process is not started
+	result, _ = libShell.NewArgsCommand("/obagent_not_exist_program").Execute()
+	assert.False(t, result.Killed)
+}
+
+func TestSetDefaultTimeout(t *testing.T) {
+	SetDefaultTimeout(MinTimeout)
+	defer SetDefaultTimeout(DefaultTimeout)
+	cmd := libShell.NewCommand("sleep 10")
+	assert.Equal(t, MinTimeout, cmd.Timeout())
+	_, err := cmd.Execute()
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+
+	// a command without timeout is bounded by the default timeout too
+	_, err = (&command{program: Sh, cmd: "sleep 10"}).Execute()
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+
+	assert.Equal(t, 5*time.Second, libShell.NewCommand("true").WithTimeout(5*time.Second).Timeout())
+}
+
+func TestWithNoTimeout(t *testing.T) {
+	assert.Panics(t, func() { libShell.NewCommand("true").WithTimeout(-time.Second) })
+	assert.Equal(t, DefaultTimeout, libShell.NewCommand("true").WithTimeout(0).Timeout())
+	assert.Equal(t, MaxTimeout, libShell.NewCommand("true").WithTimeout(time.Hour).Timeout())
+
+	SetDefaultTimeout(MinTimeout)
+	defer SetDefaultTimeout(DefaultTimeout)
+	cmd := libShell.NewCommand("sleep 1.5; echo done").WithNoTimeout()
+	assert.Equal(t, time.Duration(0), cmd.Timeout())
+	result, err := cmd.Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "done\n", result.Output)
+
+	// a later timeout overrides no timeout
+	assert.Equal(t, 5*time.Second, cmd.WithTimeout(5*time.Second).Timeout())
+}
+
+func TestExecuteCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	result, err := libShell.NewCommand("echo started; sleep 10").WithContext(ctx).WithTimeout(5 * time.Second).Execute()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.True(t, time.Since(start) < time.Second)
+	require.NotNil(t, result)
+	assert.Equal(t, "started\n", result.Output)
+}
+
+func TestExecuteContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := libShell.NewCommand("sleep 10").WithTimeout(5 * time.Second).ExecuteContext(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.True(t, time.Since(start) < time.Second)
+
+	result, err := libShell.NewCommand("exit 1").ExecuteAllowFailureContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.ExitCode)
+
+	_, err = libShell.NewCommand("exit 1").ExecuteWithDebugContext(context.Background())
+	assert.Error(t, err)
+}
+
+func TestExecuteWithMaxOutputBytes(t *testing.T) {
+	result, err := libShell.NewCommand("for i in 1 2 3 4 5; do echo 0123456789; done").WithMaxOutputBytes(15).Execute()
+	require.NoError(t, err)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, "0123456789\n0123"+truncatedMarker, result.Output)
+
+	result, err = libShell.NewCommand("echo 0123456789").WithMaxOutputBytes(15).Execute()
+	require.NoError(t, err)
+	assert.False(t, result.Truncated)
+	assert.Equal(t, "0123456789\n", result.Output)
+
+	// stderr does not take the bytes of stdout as the output
+	result, err = libShell.NewCommand("echo 0123456789 >&2; sleep 0.1; echo 0123456789").
+		WithOutputType(StdOutput).WithStderr().WithMaxOutputBytes(15).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789\n", result.Output)
+	assert.Equal(t, "0123456789\n", result.Stderr)
+}
+
+func TestExecuteArgsCommand(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "marker")
+	arg := "a; touch " + marker + " `touch " + marker + "` $(touch " + marker + ") 'b'"
+	result, err := libShell.NewArgsCommand("echo", arg).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, arg+"\n", result.Output)
+	_, err = os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+
+	command := libShell.NewArgsCommand("ls", "-d", "/tmp/a b", "it's")
+	assert.Equal(t, `'ls' '-d' '/tmp/a b' 'it'\''s'`, command.Cmd())
+	result, err = command.ExecuteAllowFailure()
+	require.NoError(t, err)
+	assert.NotEqual(t, 0, result.ExitCode)
+}
+
+func TestExecuteDuration(t *testing.T) {
+	result, err := libShell.NewCommand("sleep 0.1; exit 1").ExecuteAllowFailure()
+	require.NoError(t, err)
+	assert.True(t, result.Duration >= 100*time.Millisecond)
+	assert.Equal(t, result.Duration, result.EndedAt.Sub(result.StartedAt))
+}
+
+func TestExecuteWithStripANSI(t *testing.T) {
+	cmd := `printf '\033[31mred\033[0m plain \033[1;32mbold green\033[0m\n'`
+	result, err := libShell.NewCommand(cmd).WithStripANSI().Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "red plain bold green\n", result.Output)
+	assert.Equal(t, []string{"red plain bold green"}, result.Lines())
+
+	result, err = libShell.NewCommand(cmd).Execute()
+	require.NoError(t, err)
+	assert.Contains(t, result.Output, "\x1b[31m")
+
+	assert.Equal(t, "a [b] c", StripANSI("a [b] \x1b[Kc"))
+}
+
+func TestExecuteWithIdleTimeout(t *testing.T) {
+	start := time.Now()
+	result, err := libShell.NewCommand("echo started; sleep 10").WithIdleTimeout(200 * time.Millisecond).Execute()
+	assert.True(t, errors.Is(err, ErrIdleTimeout))
+	assert.False(t, errors.Is(err, ErrCommandTimeout))
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.NotNil(t, result)
+	assert.Equal(t, "started\n", result.Output)
+
+	// keeps running as long as output keeps coming
+	result, err = libShell.NewCommand("for i in 1 2 3 4 5 6; do echo $i >&2; sleep 0.1; done").WithIdleTimeout(time.Second).Execute()
+	require.NoError(t, err)
+	assert.Len(t, result.Lines(), 6)
+}
+
+func TestExecuteWithLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := log.New()
+	logger.SetOutput(buf)
+	logger.SetLevel(log.DebugLevel)
+	_, err := libShell.NewCommand("echo a; exit 1").WithLogger(logger.WithField("component", "monitor")).Execute()
+	assert.Error(t, err)
+	output := buf.String()
+	assert.Contains(t, output, "execute shell command start")
+	assert.Contains(t, output, "execute shell command failed")
+	assert.Contains(t, output, "component=monitor")
+}
+
+func TestExecuteResultPid(t *testing.T) {
+	result, err := libShell.NewCommand("echo $$").Execute()
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(result.Pid), strings.TrimSpace(result.Output))
+
+	p, err := libShell.NewCommand("echo $$").Start()
+	require.NoError(t, err)
+	result, err = p.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, p.Pid(), result.Pid)
+}
+
+func TestExecuteResultRusage(t *testing.T) {
+	result, err := libShell.NewCommand("i=0; while [ $i -lt 20000 ]; do i=$((i+1)); done").Execute()
+	require.NoError(t, err)
+	require.NotNil(t, result.Rusage)
+	assert.Greater(t, result.Rusage.UserTime+result.Rusage.SystemTime, time.Duration(0))
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		assert.Greater(t, result.Rusage.MaxRSS, int64(0))
+	}
+}
+
+func TestExecuteWithOutputWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	result, err := libShell.NewCommand("head -c 5000000 /dev/zero; echo err >&2").WithOutputWriter(buf).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, 5000000+len("err\n"), buf.Len())
+	assert.Empty(t, result.Output)
+	assert.Empty(t, result.Stdout)
+
+	buf.Reset()
+	result, err = libShell.NewCommand("echo out; echo err >&2").WithOutputType(StdOutput).WithStderr().WithOutputWriter(buf).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "out\n", buf.String())
+	assert.Empty(t, result.Output)
+	assert.Equal(t, "err\n", result.Stderr)
+
+	if testing.Short() {
+		return
+	}
+	buf.Reset()
+	_, err = libShell.NewCommand("echo started; sleep 10").WithOutputWriter(buf).WithTimeout(time.Second).Execute()
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	assert.Equal(t, "started\n", buf.String())
+}
+
+func TestExecuteWithOutputMasking(t *testing.T) {
+	cmd := "echo password=secret; echo access_key=secret >&2"
+	result, err := libShell.NewCommand(cmd).Execute()
+	require.NoError(t, err)
+	assert.NotContains(t, result.Output, "secret")
+	assert.NotContains(t, result.Stdout, "secret")
+	assert.NotContains(t, result.Stderr, "secret")
+	assert.Contains(t, result.Stdout, "password=xxx")
+
+	result, err = libShell.NewCommand(cmd).WithOutputMasking(false).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "password=secret\n", result.Stdout)
+
+	_, err = libShell.NewCommand("echo password=secret; exit 1").WithOutputMasking(false).Execute()
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+}
+
+func TestExecuteResultForEachLine(t *testing.T) {
+	for _, output := range []string{"", "a", "a\n", "\na\nb\n\nc\n", "\n"} {
+		r := ExecuteResult{Output: output}
+		var got []string
+		assert.NoError(t, r.ForEachLine(func(line string) error {
+			got = append(got, line)
+			return nil
+		}))
+		if len(got) == 0 {
+			got = []string{}
+		}
+		assert.Equal(t, r.Lines(), got, "output %q", output)
+	}
+
+	stop := errors.New("stop")
+	count := 0
+	err := ExecuteResult{Output: "a\nb\nc\n"}.ForEachLine(func(line string) error {
+		count++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestExecuteWithOutputEncoding(t *testing.T) {
+	// "中文" in GBK
+	cmd := `printf '\326\320\316\304\n'`
+	result, err := libShell.NewCommand(cmd).WithOutputEncoding(simplifiedchinese.GBK).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "中文\n", result.Output)
+	assert.True(t, utf8.ValidString(result.Output))
+
+	result, err = libShell.NewCommand(cmd).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "\xd6\xd0\xce\xc4\n", result.Output)
+}
+
+func TestExecuteResultOutputBytes(t *testing.T) {
+	result, err := libShell.NewCommand(`printf 'a\0\377 password=secret'`).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("a\x00\xff password=xxx"), result.Bytes())
+	assert.NotContains(t, result.Output, "secret")
+
+	result, err = libShell.NewCommand(`printf 'a\0\377 password=secret'`).WithOutputMasking(false).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("a\x00\xff password=secret"), result.Bytes())
+
+	result, err = libShell.NewCommand("echo out; echo err >&2").WithOutputType(StdOutput).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("out\n"), result.Bytes())
+
+	result, err = libShell.NewCommand(`printf '\033[1mpassword=secret'`).WithStripANSI().Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "password=xxx", result.Output)
+	assert.Equal(t, []byte("\x1b[1mpassword=xxx"), result.Bytes())
+
+	assert.Equal(t, []byte("a\n"), ExecuteResult{Output: "a\n"}.Bytes())
+}
+
+func TestGetCurrentUser(t *testing.T) {
+	currentUser, err := user.Current()
+	require.NoError(t, err)
+	assert.Equal(t, currentUser.Username, lookupCurrentUser())
+	assert.Equal(t, currentUser.Username, getCurrentUser())
+	assert.Equal(t, getCurrentUser(), getCurrentUser())
+}
+
+func TestExecuteRerun(t *testing.T) {
+	cmd := libShell.NewCommand("echo $((1 + 1))").WithUserFallback("obagent_not_exist_user", getCurrentUser())
+	for i := 0; i < 2; i++ {
+		result, err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Equal(t, "2\n", result.Output)
+		assert.Equal(t, getCurrentUser(), result.User)
+	}
+	// the fallback user is chosen for each run, the command is not changed
+	assert.Equal(t, "", cmd.User())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := cmd.Execute()
+			assert.NoError(t, err)
+			assert.Equal(t, "2\n", result.Output)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestExecuteWithExpandEnv(t *testing.T) {
+	t.Setenv("OB_HOME", "/from/agent/env")
+	vars := map[string]string{"OB_HOME": "/home/admin/oceanbase", "PORT": "2881"}
+	result, err := libShell.NewCommand("echo $OB_HOME/bin ${PORT} $$ > /dev/null; echo ${OB_HOME} $NOT_GIVEN").
+		WithExpandEnv(vars).WithEnv(map[string]string{"NOT_GIVEN": "kept"}).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "/home/admin/oceanbase kept\n", result.Output)
+
+	cmd := libShell.NewArgsCommand("echo", "${OB_HOME}/bin", "-P$PORT").WithExpandEnv(vars)
+	result, err = cmd.Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "/home/admin/oceanbase/bin -P2881\n", result.Output)
+	assert.Equal(t, []string{"echo", "/home/admin/oceanbase/bin", "-P2881"}, result.Argv)
+	// the command itself is kept, so that it can be run with other values
+	assert.Equal(t, "'echo' '${OB_HOME}/bin' '-P$PORT'", cmd.Cmd())
+}
+
+func TestIsSudoPasswordRequired(t *testing.T) {
+	sudo := exec.Command("sudo", "-n", "-u", "admin", "sh", "-c", "true")
+	assert.True(t, isSudoPasswordRequired(sudo, 1, "sudo: a password is required\n"))
+	assert.True(t, isSudoPasswordRequired(sudo, 1, "sudo: a terminal is required to read the password"))
+	// failures of the command itself
+	assert.False(t, isSudoPasswordRequired(sudo, 1, "sh: foo: command not found"))
+	assert.False(t, isSudoPasswordRequired(sudo, 2, "sudo: a password is required\n"))
+	assert.False(t, isSudoPasswordRequired(exec.Command("sh", "-c", "true"), 1, "sudo: a password is required\n"))
+
+	c := &command{program: Sh, cmd: "true", user: "admin"}
+	if getCurrentUser() != RootUser {
+		assert.Equal(t, []string{"sudo", "-n", "-u", "admin", "sh", "-c", "true"}, c.newExecCmd().Args)
+	}
+}
+
+func TestLineBuffer(t *testing.T) {
+	b := newLineBuffer(2, 2)
+	for _, p := range []string{"l1\nl", "2\nl3\n", "l4\nl5\nl6", "\nl7"} {
+		b.Write([]byte(p))
+	}
+	assert.Equal(t, "l1\nl2\n...[3 lines omitted]\nl6\nl7", b.String())
+
+	b = newLineBuffer(1, 0)
+	b.Write([]byte("l1\nl2\nl3"))
+	assert.Equal(t, "l1\n...[2 lines omitted]\n", b.String())
+
+	b = newLineBuffer(0, 2)
+	b.Write([]byte("l1\nl2\n"))
+	assert.Equal(t, "l1\nl2\n", b.String())
+	assert.Equal(t, 0, b.elided())
+}
+
+func TestExecuteWithMaxOutputLines(t *testing.T) {
+	result, err := libShell.NewCommand("seq 1 100000; echo err >&2").WithOutputType(StdOutput).WithStderr().WithMaxOutputLines(2, 3).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "1\n2\n...[99995 lines omitted]\n99998\n99999\n100000\n", result.Output)
+	assert.Equal(t, "err\n", result.Stderr)
+	assert.True(t, result.Truncated)
+
+	result, err = libShell.NewCommand("seq 1 3").WithMaxOutputLines(2, 3).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "1\n2\n3\n", result.Output)
+	assert.False(t, result.Truncated)
+}
+
+func TestExecuteResultFirstLastLine(t *testing.T) {
+	result := ExecuteResult{Output: "\n  \nstarting\r\nprogress 50%\n  status: ok  \n\n"}
+	assert.Equal(t, "starting", result.FirstLine())
+	assert.Equal(t, "status: ok", result.LastLine())
+
+	result = ExecuteResult{Output: "single"}
+	assert.Equal(t, "single", result.FirstLine())
+	assert.Equal(t, "single", result.LastLine())
+
+	for _, output := range []string{"", "\n", " \n\t\n"} {
+		result = ExecuteResult{Output: output}
+		assert.Equal(t, "", result.FirstLine())
+		assert.Equal(t, "", result.LastLine())
+	}
+}
+
+func TestExecuteResultGrep(t *testing.T) {
+	result := ExecuteResult{Output: `USER       PID COMMAND
+admin     1001 /home/admin/oceanbase/bin/observer
+admin     1002 /home/admin/obagent/bin/ob_mgragent
+root      1003 sshd: admin
+`}
+	lines, err := result.Grep(`^admin\s+\d+ .*/bin/ob`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"admin     1001 /home/admin/oceanbase/bin/observer",
+		"admin     1002 /home/admin/obagent/bin/ob_mgragent",
+	}, lines)
+
+	assert.Equal(t, []string{"root      1003 sshd: admin"}, result.GrepFixed("sshd:"))
+	assert.Equal(t, []string{}, result.GrepFixed("mysqld"))
+
+	_, err = result.Grep(`(observer`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid grep pattern")
+
+	lines, err = ExecuteResult{}.Grep(".*")
+	require.NoError(t, err)
+	assert.Empty(t, lines)
+}
+
+func TestExecuteResultClassification(t *testing.T) {
+	result, err := libShell.NewCommand("obagent_not_exist_program").ExecuteAllowFailure()
+	require.NoError(t, err)
+	assert.True(t, result.IsNotFound())
+	assert.False(t, result.IsPermissionDenied())
+	assert.False(t, result.WasKilled())
+
+	result, _ = libShell.NewArgsCommand("/obagent_not_exist_program").Execute()
+	assert.True(t, result.IsNotFound())
+
+	file := filepath.Join(t.TempDir(), "not_executable.sh")
+	require.NoError(t, os.WriteFile(file, []byte("echo a"), 0644))
+	result, err = libShell.NewCommand(file).ExecuteAllowFailure()
+	require.NoError(t, err)
+	assert.True(t, result.IsPermissionDenied())
+	result, _ = libShell.NewArgsCommand(file).Execute()
+	assert.True(t, result.IsPermissionDenied())
+	assert.False(t, result.IsNotFound())
+
+	// the shell reports the signal of its child as 128+n
+	result, err = libShell.NewCommand("sh -c 'kill -9 $$'").ExecuteAllowFailure()
+	require.NoError(t, err)
+	assert.Equal(t, 137, result.ExitCode)
+	assert.True(t, result.WasKilled())
+	assert.False(t, ExecuteResult{ExitCode: 1}.WasKilled())
+	assert.True(t, ExecuteResult{ExitCode: -1, Signaled: true}.WasKilled())
+}
+
+func TestExecuteWithOutputHash(t *testing.T) {
+	sum := func(s string) []byte {
+		h := sha256.Sum256([]byte(s))
+		return h[:]
+	}
+	h := sha256.New()
+	cmd := libShell.NewCommand("echo a; sleep 0.1; echo b >&2").WithOutputHash(h).WithMaxOutputBytes(1)
+	result, err := cmd.Execute()
+	require.NoError(t, err)
+	assert.True(t, result.Truncated)
+	// the output is hashed before truncation, the order of stdout and stderr is kept as they are written
+	assert.Equal(t, sum("a\nb\n"), result.OutputHash)
+	// the hash is reset for each run
+	result, err = cmd.Execute()
+	require.NoError(t, err)
+	assert.Equal(t, sum("a\nb\n"), result.OutputHash)
+
+	result, err = libShell.NewCommand("echo a; echo b >&2").WithOutputType(StdOutput).WithOutputHash(sha256.New()).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, sum("a\n"), result.OutputHash)
+
+	var buf bytes.Buffer
+	result, err = libShell.NewCommand("echo a").WithOutputWriter(&buf).WithOutputHash(sha256.New()).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "a\n", buf.String())
+	assert.Equal(t, sum("a\n"), result.OutputHash)
+
+	result, err = libShell.NewCommand("echo a").Execute()
+	require.NoError(t, err)
+	assert.Nil(t, result.OutputHash)
+}
+
+func TestExecuteWithFailureOutputPattern(t *testing.T) {
+	pattern := regexp.MustCompile(`(?m)^ERROR:`)
+	result, err := libShell.NewCommand("echo start; echo 'ERROR: disk full'; echo end").WithFailureOutputPattern(pattern).Execute()
+	require.Error(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 0, result.ExitCode)
+	assert.False(t, result.IsSuccessful())
+	assert.Equal(t, "ERROR: disk full", result.FailureLine)
+	assert.Contains(t, err.Error(), "output indicates failure: ERROR: disk full")
+
+	result, err = libShell.NewCommand("echo 'no ERROR: here'").WithFailureOutputPattern(pattern).Execute()
+	require.NoError(t, err)
+	assert.True(t, result.IsSuccessful())
+	assert.Equal(t, "", result.FailureLine)
+
+	// a command failing by exit code keeps failing by it
+	result, err = libShell.NewCommand("echo 'ERROR: x'; exit 2").WithFailureOutputPattern(pattern).ExecuteAllowFailure()
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.ExitCode)
+	assert.Equal(t, "", result.FailureLine)
+}
+
+func TestMatchedLine(t *testing.T) {
+	assert.Equal(t, "b ERROR c", matchedLine(regexp.MustCompile("ERROR"), "a\nb ERROR c\r\nd ERROR\n"))
+	assert.Equal(t, "", matchedLine(regexp.MustCompile("ERROR"), "a\nb\n"))
+	assert.Equal(t, "(empty line)", matchedLine(regexp.MustCompile(`(?m)^$`), "a\n\nb"))
+}
@@ -16,60 +16,59 @@
 package shell
 
 import (
-	"errors"
+	"os"
 	"os/exec"
 	"syscall"
-	"time"
-
-	log "github.com/sirupsen/logrus"
 )
 
-var TimeoutErr = errors.New("Command timed out.")
-
-// KillGrace is the amount of time we allow a process to shutdown before
-// sending a SIGKILL.
-const KillGrace = 5 * time.Second
+// defaultProgram is the shell program of commands by default.
+const defaultProgram = DefaultProgram
 
-// WaitTimeout waits for the given command to finish with a timeout.
-// It assumes the command has already been started.
-// If the command times out, it attempts to kill the process.
-func WaitTimeout(c *exec.Cmd, timeout time.Duration) error {
-	var kill *time.Timer
-	term := time.AfterFunc(timeout, func() {
-		err := c.Process.Signal(syscall.SIGTERM)
-		if err != nil {
-			log.Errorf("[agent] Error terminating process: %s", err)
-			return
-		}
+// fallbackShell is the shell available on every unix host.
+const fallbackShell = "/bin/sh"
 
-		kill = time.AfterFunc(KillGrace, func() {
-			err := c.Process.Kill()
-			if err != nil {
-				log.Errorf("[agent] Error killing process: %s", err)
-				return
-			}
-		})
-	})
+// userSwitchSupported is whether commands can run as other users by runuser or sudo.
+const userSwitchSupported = true
 
-	err := c.Wait()
+// signalSupported is whether signals other than kill can be sent to processes.
+const signalSupported = true
 
-	// Shutdown all timers
-	if kill != nil {
-		kill.Stop()
+// setProcessGroup makes the command the leader of a new process group,
+// so that it can be killed together with all its children.
+func setProcessGroup(c *exec.Cmd) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
 	}
-	termSent := !term.Stop()
+	c.SysProcAttr.Setpgid = true
+}
 
-	// If the process exited without error treat it as success.  This allows a
-	// process to do a clean shutdown on signal.
-	if err == nil {
-		return nil
+// setDetached makes the command the leader of a new session, detached from the process group
+// and the controlling terminal of the agent, so that it survives the agent.
+func setDetached(c *exec.Cmd) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
 	}
+	c.SysProcAttr.Setsid = true
+}
 
-	// If SIGTERM was sent then treat any process error as a timeout.
-	if termSent {
-		return TimeoutErr
+// setCredential makes the command run with the credential.
+func setCredential(c *exec.Cmd, credential *Credential) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
 	}
+	c.SysProcAttr.Credential = &syscall.Credential{
+		Uid:    credential.Uid,
+		Gid:    credential.Gid,
+		Groups: credential.Groups,
+	}
+}
 
-	// Otherwise there was an error unrelated to termination.
+// signalProcessGroup sends the signal to the process group led by the process.
+// If the process is not a group leader, e.g. it was not started by this package, only the process is signaled.
+func signalProcessGroup(p *os.Process, sig syscall.Signal) error {
+	err := syscall.Kill(-p.Pid, sig)
+	if err == syscall.ESRCH {
+		return p.Signal(sig)
+	}
 	return err
 }
@@ -0,0 +1,273 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+//go:build !windows
+// +build !windows
+
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// processAlive reports whether the process exists and is not a zombie.
+func processAlive(pid int) bool {
+	if err := syscall.Kill(pid, 0); err != nil {
+		return false
+	}
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(stat))
+	return len(fields) < 3 || fields[2] != "Z"
+}
+
+func TestCombinedOutputTimeoutKillsProcessGroup(t *testing.T) {
+	if shell == "" || sleepbin == "" {
+		t.Skip("'sh' or 'sleep' binary not available on OS, skipping.")
+	}
+	cmd := exec.Command(shell, "-c", sleepbin+" 30 & echo $!; wait")
+	out, err := CombinedOutputTimeout(cmd, 500*time.Millisecond)
+	assert.Equal(t, ErrCommandTimeout, err)
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return !processAlive(pid)
+	}, 2*time.Second, 20*time.Millisecond, "background child %d survives the timeout", pid)
+}
+
+func TestExecuteKilledBySignal(t *testing.T) {
+	result, err := libShell.NewCommand("kill -9 $$").ExecuteAllowFailure()
+	require.NoError(t, err)
+	assert.True(t, result.Signaled)
+	assert.Equal(t, syscall.SIGKILL, result.Signal)
+	assert.Contains(t, result.AsError().Error(), "killed by signal 9")
+
+	result, err = libShell.NewCommand("exit 3").ExecuteAllowFailure()
+	require.NoError(t, err)
+	assert.False(t, result.Signaled)
+	assert.Contains(t, result.AsError().Error(), "exitCode: 3")
+}
+
+func TestExecuteWithKillGrace(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test due to long running.")
+	}
+	cmd := "trap 'echo trapped; exit 0' TERM; echo ready; while true; do sleep 0.05; done"
+	result, err := libShell.NewCommand(cmd).WithTimeout(time.Second).WithKillGrace(2 * time.Second).Execute()
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	require.NotNil(t, result)
+	assert.Contains(t, result.Lines(), "trapped")
+	assert.False(t, result.Signaled)
+
+	// without grace the trap has no chance to run
+	result, err = libShell.NewCommand(cmd).WithTimeout(time.Second).Execute()
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	require.NotNil(t, result)
+	assert.NotContains(t, result.Lines(), "trapped")
+	assert.True(t, result.Signaled)
+}
+
+func TestExecuteWithTimeoutSignal(t *testing.T) {
+	cmd := "trap 'echo interrupted; exit 0' INT; trap 'echo terminated; exit 0' TERM; echo ready; while true; do sleep 0.05; done"
+	result, err := libShell.NewCommand(cmd).WithTimeout(500 * time.Millisecond).WithTimeoutSignal(syscall.SIGINT).Execute()
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	require.NotNil(t, result)
+	assert.Contains(t, result.Lines(), "interrupted")
+	assert.NotContains(t, result.Lines(), "terminated")
+	assert.True(t, result.Killed)
+
+	// SIGKILL kills immediately, the traps have no chance to run
+	result, err = libShell.NewCommand(cmd).WithTimeout(500 * time.Millisecond).WithTimeoutSignal(syscall.SIGKILL).Execute()
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	require.NotNil(t, result)
+	assert.Equal(t, []string{"ready"}, result.Lines())
+	assert.True(t, result.Signaled)
+}
+
+func TestExecuteWithCredential(t *testing.T) {
+	if getCurrentUser() != RootUser {
+		_, err := libShell.NewCommand("id -u").WithCredential(65534, 65534, nil).Execute()
+		assert.Error(t, err)
+		return
+	}
+	result, err := libShell.NewCommand("id -u; id -g; id -G").WithCredential(65534, 65534, []uint32{65534, 100}).Execute()
+	require.NoError(t, err)
+	lines := result.Lines()
+	require.Len(t, lines, 3)
+	assert.Equal(t, "65534", lines[0])
+	assert.Equal(t, "65534", lines[1])
+	assert.ElementsMatch(t, []string{"65534", "100"}, strings.Fields(lines[2]))
+
+	result, err = libShell.NewScript("id -u").WithCredential(65534, 65534, nil).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "65534\n", result.Output)
+}
+
+func TestExecuteWithChroot(t *testing.T) {
+	if runtime.GOOS != "linux" || getCurrentUser() != RootUser {
+		_, err := libShell.NewCommand("echo a").WithChroot("/").Execute()
+		assert.Error(t, err)
+		return
+	}
+	result, err := libShell.NewCommand("echo a").WithChroot("/").Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "a\n", result.Output)
+
+	result, err = libShell.NewScript("echo $0").WithChroot("/").Execute()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(result.Output, os.TempDir()))
+
+	// there is no shell inside an empty root directory
+	_, err = libShell.NewCommand("echo a").WithChroot(t.TempDir()).Execute()
+	assert.Error(t, err)
+
+	_, err = libShell.NewCommand("echo a").WithChroot("/not/exist").Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid root directory /not/exist")
+}
+
+func TestExecuteWithNice(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("nice is only supported on linux")
+	}
+	// children forked by the shell have the priority too, the priority is applied right after the shell starts
+	result, err := libShell.NewCommand("sleep 0.1; cat /proc/self/stat | awk '{print $19}'").WithNice(10).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "10\n", result.Output)
+
+	if ionice, err := exec.LookPath("ionice"); err == nil {
+		result, err = libShell.NewCommand("sleep 0.1; " + ionice + " -p $$").WithIONice(2, 7).Execute()
+		require.NoError(t, err)
+		assert.Equal(t, "best-effort: prio 7\n", result.Output)
+	}
+
+	// invalid priority is logged instead of failing the command
+	result, err = libShell.NewCommand("echo a").WithIONice(9, 9).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "a\n", result.Output)
+}
+
+func TestExecuteWithDryRun(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dry-run")
+	result, err := libShell.NewCommand("touch " + file + " --password=secret").WithDryRun().Execute()
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, QuoteArgs([]string{"sh", "-c", "touch " + file + " --password=xxx"}), result.Command)
+	assert.Equal(t, []string{"sh", "-c", "touch " + file + " --password=xxx"}, result.Argv)
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+
+	if _, err := user.Lookup("nobody"); err != nil {
+		t.Skip("user nobody not exists")
+	}
+	result, err = libShell.NewArgsCommand("touch", file).WithUser("nobody").WithDryRun().Execute()
+	require.NoError(t, err)
+	if getCurrentUser() == RootUser {
+		assert.Equal(t, QuoteArgs([]string{"runuser", "-u", "nobody", "--", "touch", file}), result.Command)
+	} else {
+		assert.Equal(t, QuoteArgs([]string{"sudo", "-n", "-u", "nobody", "--", "touch", file}), result.Command)
+	}
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExecuteResultArgv(t *testing.T) {
+	result, err := libShell.NewCommand("echo password=secret").Execute()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sh", "-c", "echo password=xxx"}, result.Argv)
+
+	result, err = libShell.NewArgsCommand("echo", "a b").WithUser(getCurrentUser()).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo", "a b"}, result.Argv)
+
+	if _, err := user.Lookup("nobody"); err != nil || getCurrentUser() != RootUser {
+		t.Skip("switching to user nobody is not possible")
+	}
+	// the login shell of nobody may refuse to run the command, the argv is kept anyway
+	result, err = libShell.NewCommand("true").WithUser("nobody").ExecuteAllowFailure()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"runuser", "-l", "nobody", "-c", "true"}, result.Argv)
+}
+
+func TestExecuteWithEnvAsUser(t *testing.T) {
+	// runuser -l and sudo reset the environment, the variables are passed through them
+	env := []string{"FOO=bar baz"}
+	c := &command{program: Sh, cmd: "echo $FOO", user: "admin", env: env}
+	args := &command{argv: []string{"env"}, cmd: "env", user: "admin", env: env}
+	if getCurrentUser() == RootUser {
+		assert.Equal(t, []string{"runuser", "-l", "admin", "-c", "export FOO='bar baz'; echo $FOO"}, c.newExecCmd().Args)
+		assert.Equal(t, []string{"runuser", "-u", "admin", "--", "env"}, args.newExecCmd().Args)
+		assert.Contains(t, args.newExecCmd().Env, "FOO=bar baz")
+	} else {
+		assert.Equal(t, []string{"sudo", "-n", "-u", "admin", "FOO=bar baz", "sh", "-c", "echo $FOO"}, c.newExecCmd().Args)
+		assert.Equal(t, []string{"sudo", "-n", "-u", "admin", "FOO=bar baz", "--", "env"}, args.newExecCmd().Args)
+	}
+
+	if _, err := user.Lookup("nobody"); err != nil || getCurrentUser() != RootUser {
+		t.Skip("switching to user nobody is not possible")
+	}
+	result, err := libShell.NewCommand("echo $FOO").WithUser("nobody").WithEnv(map[string]string{"FOO": "bar baz"}).ExecuteAllowFailure()
+	require.NoError(t, err)
+	if result.ExitCode != 0 {
+		t.Skip("the login shell of nobody refuses to run the command")
+	}
+	assert.Equal(t, "bar baz\n", result.Output)
+}
+
+func TestExecuteInDirAsUser(t *testing.T) {
+	if getCurrentUser() != RootUser {
+		t.Skip("the working directory is only changed by the script of runuser for root")
+	}
+	marker := filepath.Join(t.TempDir(), "marker")
+	c := &command{program: Sh, cmd: "echo a; touch " + marker, user: "admin", dir: "/obagent_not_exist_dir"}
+	args := c.newExecCmd().Args
+	assert.Equal(t, []string{"runuser", "-l", "admin", "-c", "cd '/obagent_not_exist_dir' || exit 1; echo a; touch " + marker}, args)
+	// none of the commands run if the working directory can not be changed to
+	assert.Error(t, exec.Command("sh", "-c", args[4]).Run())
+	_, err := os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExecuteResultOnStartError(t *testing.T) {
+	result, err := libShell.NewArgsCommand("/obagent_not_exist_program", "password=secret").Execute()
+	require.Error(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, -1, result.ExitCode)
+	assert.Contains(t, result.Command, "obagent_not_exist_program")
+	assert.NotContains(t, result.Command, "secret")
+	assert.Contains(t, result.Output, "no such file or directory")
+
+	// failed in preflight
+	result, err = libShell.NewCommand("echo a").WithShell("obagent_not_exist_shell").Execute()
+	require.Error(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, -1, result.ExitCode)
+	assert.Contains(t, result.Output, "shell obagent_not_exist_shell not found in PATH")
+}
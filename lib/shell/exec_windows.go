@@ -16,40 +16,41 @@
 package shell
 
 import (
+	"os"
 	"os/exec"
-	"time"
-
-	log "github.com/sirupsen/logrus"
+	"syscall"
 )
 
-// WaitTimeout waits for the given command to finish with a timeout.
-// It assumes the command has already been started.
-// If the command times out, it attempts to kill the process.
-func WaitTimeout(c *exec.Cmd, timeout time.Duration) error {
-	timer := time.AfterFunc(timeout, func() {
-		err := c.Process.Kill()
-		if err != nil {
-			log.Errorf("[agent] Error killing process: %s", err)
-			return
-		}
-	})
-
-	err := c.Wait()
-
-	// Shutdown all timers
-	termSent := !timer.Stop()
-
-	// If the process exited without error treat it as success.  This allows a
-	// process to do a clean shutdown on signal.
-	if err == nil {
-		return nil
-	}
+// defaultProgram is the shell program of commands by default, sh is not available on windows.
+const defaultProgram = Cmd
+
+// fallbackShell is the shell available on every windows host.
+const fallbackShell = "cmd"
+
+// userSwitchSupported is false on windows, where there is no runuser or sudo.
+// Commands with a user other than current user are rejected before starting, see validateUser.
+const userSwitchSupported = false
+
+// signalSupported is false on windows, where sending any signal kills the process.
+const signalSupported = false
 
-	// If SIGTERM was sent then treat any process error as a timeout.
-	if termSent {
-		return TimeoutErr
+// setProcessGroup does nothing on windows, there is no process group to set.
+func setProcessGroup(c *exec.Cmd) {
+}
+
+// setDetached makes the command run in a new process group, so that it does not receive the console events of the agent.
+func setDetached(c *exec.Cmd) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
 	}
+	c.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// setCredential does nothing on windows, credential is rejected before starting the command.
+func setCredential(c *exec.Cmd, credential *Credential) {
+}
 
-	// Otherwise there was an error unrelated to termination.
-	return err
+// signalProcessGroup kills the process on windows, where signals other than kill are not supported.
+func signalProcessGroup(p *os.Process, sig syscall.Signal) error {
+	return p.Kill()
 }
@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/oceanbase/obagent/lib/mask"
+)
+
+// jsonErrorOutputBytes is the max bytes of output to include in the error when the output is not valid JSON.
+const jsonErrorOutputBytes = 256
+
+// ExecuteJSON executes the command like Execute, and on success unmarshals its stdout into v.
+// If the stdout is not valid JSON, it returns the result and an error including the beginning of the output.
+func (c *command) ExecuteJSON(v interface{}) (*ExecuteResult, error) {
+	executeResult, err := c.Execute()
+	if err != nil {
+		return executeResult, err
+	}
+	if err = json.Unmarshal([]byte(executeResult.Stdout), v); err != nil {
+		output := executeResult.Stdout
+		if len(output) > jsonErrorOutputBytes {
+			output = output[:jsonErrorOutputBytes] + "..."
+		}
+		return executeResult, errors.Wrapf(err, "output of shell command %s is not valid JSON, output: %s", mask.Mask(c.cmd), mask.Mask(output))
+	}
+	return executeResult, nil
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteJSON(t *testing.T) {
+	var v struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	result, err := libShell.NewCommand(`echo '{"name": "observer", "count": 3}'; echo warning >&2`).ExecuteJSON(&v)
+	require.NoError(t, err)
+	assert.True(t, result.IsSuccessful())
+	assert.Equal(t, "observer", v.Name)
+	assert.Equal(t, 3, v.Count)
+
+	_, err = libShell.NewCommand("echo not json").ExecuteJSON(&v)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not valid JSON")
+	assert.Contains(t, err.Error(), "not json")
+
+	_, err = libShell.NewCommand("printf '%0300d' 0").ExecuteJSON(&v)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), strings.Repeat("0", jsonErrorOutputBytes)+"...")
+
+	_, err = libShell.NewCommand(`echo '{}'; exit 1`).ExecuteJSON(&v)
+	assert.Error(t, err)
+}
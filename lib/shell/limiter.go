@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// concurrencyLimiter limits the number of commands executing at the same time, and drains them on Shutdown.
+var concurrencyLimiter limiter
+
+type limiter struct {
+	mu        sync.Mutex
+	slots     chan struct{}          // nil means unlimited
+	inflight  int                    // number of commands holding or waiting for a slot
+	processes map[*os.Process]func() // processes of the commands in flight, to kill on Shutdown, with their onKill
+	closing   chan struct{}          // closed by Shutdown, created on demand
+	shutdown  bool                   // whether Shutdown is called, no more command is accepted then
+	drained   chan struct{}          // closed when no command is in flight after Shutdown
+}
+
+// SetMaxConcurrent limits the number of commands run by Execute and its variants at the same time to n,
+// a command waits for a slot before starting. n <= 0 means unlimited, which is the default.
+// Background processes started by Start are not limited.
+// Commands running when the limit changes release their slots to the previous limit.
+func SetMaxConcurrent(n int) {
+	concurrencyLimiter.mu.Lock()
+	defer concurrencyLimiter.mu.Unlock()
+	if n <= 0 {
+		concurrencyLimiter.slots = nil
+	} else {
+		concurrencyLimiter.slots = make(chan struct{}, n)
+	}
+}
+
+// acquire blocks until a slot is available or ctx is done, it returns a function to release the slot.
+// It fails with ErrShuttingDown after Shutdown is called.
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	l.mu.Lock()
+	if l.shutdown {
+		l.mu.Unlock()
+		return nil, ErrShuttingDown
+	}
+	slots := l.slots
+	closing := l.closingChan()
+	l.inflight++
+	l.mu.Unlock()
+	if slots == nil {
+		return l.done, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() {
+			<-slots
+			l.done()
+		}, nil
+	case <-ctx.Done():
+		l.done()
+		return nil, ctx.Err()
+	case <-closing:
+		l.done()
+		return nil, ErrShuttingDown
+	}
+}
+
+// closingChan returns the channel closed by Shutdown, l.mu must be held.
+func (l *limiter) closingChan() chan struct{} {
+	if l.closing == nil {
+		l.closing = make(chan struct{})
+	}
+	return l.closing
+}
+
+// done marks a command acquired a slot as finished.
+func (l *limiter) done() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	if l.shutdown && l.inflight == 0 {
+		close(l.drained)
+	}
+}
+
+// track keeps the process of a command in flight, so that it is killed if Shutdown times out,
+// onKill is called then if not nil, e.g. to stop the output throttle blocking the wait for the process.
+// It returns a function to stop tracking the process once it exits.
+func (l *limiter) track(p *os.Process, onKill func()) func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.processes == nil {
+		l.processes = make(map[*os.Process]func())
+	}
+	l.processes[p] = onKill
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.processes, p)
+	}
+}
+
+// Shutdown stops accepting new commands run by Execute and its variants, and waits for the running ones to finish.
+// Commands started after it, or waiting for a slot of SetMaxConcurrent, fail with ErrShuttingDown.
+// If ctx is done before the running commands finish, they are killed together with their children,
+// and the error of ctx is returned. Background processes started by Start are not waited for.
+// It should be called once when the agent exits, calling it again only waits for the commands like the first time.
+func Shutdown(ctx context.Context) error {
+	return concurrencyLimiter.shutdownAndWait(ctx)
+}
+
+func (l *limiter) shutdownAndWait(ctx context.Context) error {
+	l.mu.Lock()
+	if !l.shutdown {
+		l.shutdown = true
+		l.drained = make(chan struct{})
+		close(l.closingChan())
+		if l.inflight == 0 {
+			close(l.drained)
+		}
+	}
+	drained := l.drained
+	l.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for p, onKill := range l.processes {
+		_ = signalProcessGroup(p, syscall.SIGKILL)
+		if onKill != nil {
+			onKill()
+		}
+	}
+	return errors.Wrapf(ctx.Err(), "shutdown shell with %d commands running, killed", len(l.processes))
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMaxConcurrent(t *testing.T) {
+	SetMaxConcurrent(2)
+	defer SetMaxConcurrent(0)
+
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := concurrencyLimiter.acquire(context.Background())
+			if !assert.NoError(t, err) {
+				return
+			}
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			release()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), maxRunning)
+
+	start := time.Now()
+	var cwg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			_, err := libShell.NewCommand("sleep 0.2").Execute()
+			assert.NoError(t, err)
+		}()
+	}
+	cwg.Wait()
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+}
+
+func TestSetMaxConcurrentCancel(t *testing.T) {
+	SetMaxConcurrent(1)
+	defer SetMaxConcurrent(0)
+	release, err := concurrencyLimiter.acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = libShell.NewCommand("echo a").WithContext(ctx).Execute()
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// inflightCount returns the number of commands in flight.
+func (l *limiter) inflightCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+func TestShutdown(t *testing.T) {
+	defer func() {
+		concurrencyLimiter = limiter{}
+	}()
+	errCh := make(chan error, 2)
+	go func() {
+		_, err := libShell.NewCommand("sleep 0.3").Execute()
+		errCh <- err
+	}()
+	go func() {
+		_, err := libShell.NewCommand("sleep 30").Execute()
+		errCh <- err
+	}()
+	require.Eventually(t, func() bool {
+		return concurrencyLimiter.inflightCount() == 2
+	}, time.Second, 10*time.Millisecond)
+	// wait for the processes to start
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	err := Shutdown(ctx)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Contains(t, err.Error(), "1 commands running")
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	// the short one finishes, the long one is killed
+	assert.NoError(t, <-errCh)
+	select {
+	case err = <-errCh:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("command not killed")
+	}
+
+	_, err = libShell.NewCommand("echo a").Execute()
+	assert.True(t, errors.Is(err, ErrShuttingDown))
+	lines, streamErr := libShell.NewCommand("echo a").ExecuteStream(context.Background())
+	for range lines {
+	}
+	assert.True(t, errors.Is(<-streamErr, ErrShuttingDown))
+	// all drained
+	assert.NoError(t, Shutdown(context.Background()))
+}
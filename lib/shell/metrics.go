@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricNameKey   = "name"
+	metricStatusKey = "status"
+
+	// defaultMetricName is the name label of commands without a metric name
+	defaultMetricName = "unnamed"
+)
+
+const (
+	metricStatusSuccess      = "success"
+	metricStatusFailure      = "failure"
+	metricStatusTimeout      = "timeout"
+	metricStatusIdleTimeout  = "idle_timeout"
+	metricStatusRateExceeded = "output_rate_exceeded"
+	metricStatusCancelled    = "cancelled"
+	metricStatusError        = "error"
+)
+
+var (
+	metricsEnabled int32
+
+	// commandTotal shell command execute total
+	commandTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ob_agent_shell_command_total",
+		Help: "The total number of shell commands executed",
+	}, []string{metricNameKey, metricStatusKey})
+
+	// commandDurationSeconds shell command execute duration
+	commandDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ob_agent_shell_command_duration_seconds",
+		Help:    "Bucketed histogram of execute time (s) of shell commands",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+	}, []string{metricNameKey, metricStatusKey})
+)
+
+// RegisterMetrics registers the metrics of shell command execution to reg and enables collecting them.
+// Commands are labeled by the name set by WithMetricName rather than the command itself, to bound the cardinality.
+// Nothing is collected until it is called, the agents register them by stat.RegisterStat.
+func RegisterMetrics(reg prometheus.Registerer) error {
+	if err := reg.Register(commandTotal); err != nil {
+		return errors.Wrap(err, "register shell command metrics")
+	}
+	if err := reg.Register(commandDurationSeconds); err != nil {
+		reg.Unregister(commandTotal)
+		return errors.Wrap(err, "register shell command metrics")
+	}
+	atomic.StoreInt32(&metricsEnabled, 1)
+	return nil
+}
+
+// WithMetricName sets the name label of the command in metrics.
+func (c *command) WithMetricName(name string) Command {
+	c.metricName = name
+	return c
+}
+
+// observeMetrics records the execution of the command if metrics are registered.
+func (c *command) observeMetrics(executeResult *ExecuteResult, err error) {
+	if atomic.LoadInt32(&metricsEnabled) == 0 || c.dryRun {
+		return
+	}
+	name := c.metricName
+	if name == "" {
+		name = defaultMetricName
+	}
+	status := metricStatus(executeResult, err)
+	commandTotal.WithLabelValues(name, status).Inc()
+	if executeResult != nil && !executeResult.StartedAt.IsZero() {
+		commandDurationSeconds.WithLabelValues(name, status).Observe(executeResult.Duration.Seconds())
+	}
+}
+
+func metricStatus(executeResult *ExecuteResult, err error) string {
+	switch {
+	case errors.Is(err, ErrCommandTimeout):
+		return metricStatusTimeout
+	case errors.Is(err, ErrIdleTimeout):
+		return metricStatusIdleTimeout
+	case errors.Is(err, ErrOutputRateExceeded):
+		return metricStatusRateExceeded
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return metricStatusCancelled
+	case err != nil, executeResult == nil:
+		return metricStatusError
+	case executeResult.IsSuccessful():
+		return metricStatusSuccess
+	default:
+		return metricStatusFailure
+	}
+}
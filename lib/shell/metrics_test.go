@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	require.NoError(t, RegisterMetrics(reg))
+	assert.Error(t, RegisterMetrics(reg))
+
+	// the counters are global, only the increments by this test are checked
+	counted := func(name, status string) float64 {
+		return testutil.ToFloat64(commandTotal.WithLabelValues(name, status))
+	}
+	type labels struct{ name, status string }
+	before := make(map[labels]float64)
+	for _, l := range []labels{
+		{"test_echo", metricStatusSuccess},
+		{"test_echo", metricStatusFailure},
+		{"test_sleep", metricStatusTimeout},
+		{"test_idle", metricStatusIdleTimeout},
+		{"test_rate", metricStatusRateExceeded},
+		{defaultMetricName, metricStatusSuccess},
+	} {
+		before[l] = counted(l.name, l.status)
+	}
+
+	_, _ = libShell.NewCommand("echo a").WithMetricName("test_echo").Execute()
+	_, _ = libShell.NewCommand("exit 1").WithMetricName("test_echo").Execute()
+	_, _ = libShell.NewCommand("sleep 10").WithMetricName("test_sleep").WithTimeout(10 * time.Millisecond).Execute()
+	_, _ = libShell.NewCommand("echo a; sleep 10").WithMetricName("test_idle").WithIdleTimeout(10 * time.Millisecond).Execute()
+	_, _ = libShell.NewCommand("cat /dev/zero").WithMetricName("test_rate").WithOutputRateLimit(10000).
+		WithOutputRateLimitKill(10 * time.Millisecond).WithMaxOutputBytes(1000).Execute()
+	_, _ = libShell.NewCommand("echo a").Execute()
+
+	for l, n := range before {
+		if l.name == defaultMetricName {
+			// commands of other tests may run in parallel
+			assert.LessOrEqual(t, n+1, counted(l.name, l.status))
+			continue
+		}
+		assert.Equal(t, n+1, counted(l.name, l.status), "%s %s", l.name, l.status)
+	}
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	var names []string
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	assert.Contains(t, names, "ob_agent_shell_command_total")
+	assert.Contains(t, names, "ob_agent_shell_command_duration_seconds")
+}
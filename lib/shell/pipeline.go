@@ -0,0 +1,299 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oceanbase/obagent/lib/mask"
+	agentlog "github.com/oceanbase/obagent/log"
+)
+
+// Pipeline runs commands with the stdout of each connected to the stdin of the next, like a | b | c in a shell,
+// but with the exit code of each stage kept, like PIPESTATUS of bash.
+// The stages are connected by OS pipes, so a stage exiting early, e.g. head, stops the previous one by SIGPIPE.
+type Pipeline struct {
+	commands []Command
+	timeout  time.Duration
+	context  context.Context
+}
+
+// PipelineResult is the result of each stage of a pipeline.
+type PipelineResult struct {
+	Command   string           // stages joined by |, masked
+	Stages    []*ExecuteResult // result of each stage, the stdout of all but the last stage is piped and not kept
+	ExitCodes []int            // exit code of each stage, like PIPESTATUS of bash
+	Output    string           // output of the last stage
+}
+
+// NewPipeline creates a pipeline of commands, which should be created by Shell.
+// The options of the stages apply to them, except for their timeouts and contexts, the ones of the pipeline apply instead.
+// The idle timeout is only supported by the last stage, as the stdout of the others is piped without being watched.
+func NewPipeline(commands ...Command) *Pipeline {
+	return &Pipeline{
+		commands: commands,
+	}
+}
+
+// WithTimeout limits the time of running the whole pipeline, all the stages are killed when it elapses.
+// 0 means the default timeout, see SetDefaultTimeout. It panics if timeout is negative.
+func (p *Pipeline) WithTimeout(timeout time.Duration) *Pipeline {
+	p.timeout = normalizeTimeout(timeout)
+	return p
+}
+
+// WithContext makes the pipeline killed when ctx is done.
+func (p *Pipeline) WithContext(ctx context.Context) *Pipeline {
+	p.context = ctx
+	return p
+}
+
+func (p *Pipeline) String() string {
+	cmds := make([]string, 0, len(p.commands))
+	for _, c := range p.commands {
+		cmds = append(cmds, mask.Mask(c.Cmd()))
+	}
+	return strings.Join(cmds, " | ")
+}
+
+// ExitCode returns the exit code of the rightmost failed stage, or 0 if all the stages succeed, like pipefail of bash.
+func (r PipelineResult) ExitCode() int {
+	for i := len(r.ExitCodes) - 1; i >= 0; i-- {
+		if r.ExitCodes[i] != 0 {
+			return r.ExitCodes[i]
+		}
+	}
+	return 0
+}
+
+func (r PipelineResult) IsSuccessful() bool {
+	return r.ExitCode() == 0
+}
+
+// AsError returns an error with the exit code of each stage if any stage fails, or nil.
+func (r PipelineResult) AsError() error {
+	if r.IsSuccessful() {
+		return nil
+	}
+	return errors.Errorf("failed to execute pipeline: %s, exitCodes: %v, output: %s", r.Command, r.ExitCodes, mask.Mask(r.Output))
+}
+
+// Execute runs the stages of the pipeline and waits for all of them to exit.
+// A stage failing does not make an error, check ExitCodes or IsSuccessful of the result instead.
+// If the pipeline times out or ctx is done, or a stage is killed for its output, e.g. by its idle timeout or output rate,
+// all the stages are killed, and the result is returned with the error. The pipeline takes a single slot of the concurrent commands, see SetMaxConcurrent, and its stages are waited for
+// by Shutdown. It can not run by the runner set by SetRunner, so it fails while one is set.
+func (p *Pipeline) Execute() (*PipelineResult, error) {
+	parent := p.context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx := context.WithValue(parent, agentlog.StartTimeKey, time.Now())
+	logger := p.logger(ctx)
+	logger.Infof("execute shell pipeline start, pipeline=%s", p.String())
+	if currentRunner() != nil {
+		err := errors.New("pipeline is not supported by the runner set by SetRunner")
+		logger.Errorf("execute shell pipeline error, pipeline=%s, error=%s", p.String(), err)
+		return nil, errors.Wrapf(err, "error when execute shell pipeline %s", p.String())
+	}
+	stages, err := p.stages()
+	if err != nil {
+		logger.Errorf("execute shell pipeline error, pipeline=%s, error=%s", p.String(), err)
+		return nil, errors.Wrapf(err, "error when execute shell pipeline %s", p.String())
+	}
+	release, err := concurrencyLimiter.acquire(ctx)
+	if err != nil {
+		logger.Errorf("execute shell pipeline cancelled while waiting for a slot, pipeline=%s, error=%s", p.String(), err)
+		return nil, errors.Wrapf(err, "shell pipeline %s cancelled while waiting for a slot", p.String())
+	}
+	defer release()
+
+	cmds := make([]*exec.Cmd, len(stages))
+	captures := make([]*outputCapture, len(stages))
+	for i, stage := range stages {
+		run, removeScript, err := stage.prepareScript()
+		if err != nil {
+			logger.Errorf("execute shell pipeline error, pipeline=%s, error=%s", p.String(), err)
+			return nil, errors.Wrapf(err, "error when execute shell pipeline %s", p.String())
+		}
+		defer removeScript()
+		cmds[i] = run.newExecCmd()
+		captures[i] = stage.newOutputCapture()
+		if stage.idleTimeout > 0 {
+			captures[i].idle = newIdleWatch(stage.idleTimeout, captures[i].abort)
+			defer captures[i].idle.stop()
+		}
+		cmds[i].Stderr = captures[i].stderrWriter()
+	}
+	cmds[len(cmds)-1].Stdout = captures[len(cmds)-1].stdoutWriter()
+
+	releases, startedAt, err := p.start(ctx, stages, cmds)
+	if err != nil {
+		logger.Errorf("execute shell pipeline error, pipeline=%s, error=%s", p.String(), err)
+		return nil, errors.Wrapf(err, "error when execute shell pipeline %s", p.String())
+	}
+
+	// the stages are killed when the pipeline times out or ctx is done
+	waitCtx, cancel := context.WithTimeout(ctx, timeoutOrDefault(p.timeout))
+	defer cancel()
+	// the other stages are killed too when a stage is killed for its output
+	stageCtx, abortStages := context.WithCancel(waitCtx)
+	defer abortStages()
+	waitErrs := make([]error, len(stages))
+	var wg sync.WaitGroup
+	for i := range stages {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			untrack := concurrencyLimiter.track(cmds[i].Process, captures[i].stopThrottle)
+			waitErrs[i] = waitCommand(stageCtx, cmds[i], 0, captures[i].abort, captures[i].terminatePolicy(stages[i].terminatePolicy()))
+			untrack()
+			releases[i]()
+			if isOutputAbort(waitErrs[i]) {
+				abortStages()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	result := &PipelineResult{Command: p.String()}
+	var stageErr, abortErr error
+	for i, stage := range stages {
+		waitErr := waitErrs[i]
+		if waitErr == context.DeadlineExceeded && ctx.Err() == nil {
+			waitErr = ErrCommandTimeout
+		}
+		resultCtx := ctx
+		if waitErr == context.Canceled && waitCtx.Err() == nil {
+			// cancelled by another stage killed for its output
+			resultCtx = stageCtx
+		}
+		stageResult, err := stage.newExecuteResult(resultCtx, info, captures[i], cmds[i], startedAt[i], waitErr)
+		if err != nil && stageErr == nil {
+			stageErr = err
+		}
+		if isOutputAbort(waitErr) && abortErr == nil {
+			abortErr = err
+		}
+		result.Stages = append(result.Stages, stageResult)
+		result.ExitCodes = append(result.ExitCodes, stageResult.ExitCode)
+	}
+	result.Output = result.Stages[len(result.Stages)-1].Output
+
+	if waitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		logger.Errorf("execute shell pipeline timeout, pipeline=%s, timeout=%s", p.String(), timeoutOrDefault(p.timeout))
+		return result, errors.Wrapf(ErrCommandTimeout, "shell pipeline %s timed out after %s", p.String(), timeoutOrDefault(p.timeout))
+	}
+	if ctx.Err() != nil {
+		logger.Errorf("execute shell pipeline cancelled, pipeline=%s, error=%s", p.String(), ctx.Err())
+		return result, errors.Wrapf(ctx.Err(), "shell pipeline %s cancelled", p.String())
+	}
+	if abortErr != nil {
+		logger.Errorf("execute shell pipeline error, pipeline=%s, error=%s", p.String(), abortErr)
+		return result, errors.Wrapf(abortErr, "error when execute shell pipeline %s", p.String())
+	}
+	if stageErr != nil {
+		logger.Errorf("execute shell pipeline error, pipeline=%s, error=%s", p.String(), stageErr)
+		return result, errors.Wrapf(stageErr, "error when execute shell pipeline %s", p.String())
+	}
+	logger.Infof("execute shell pipeline end, pipeline=%s, exitCodes=%v", p.String(), result.ExitCodes)
+	return result, nil
+}
+
+// isOutputAbort reports whether the stage is killed for its output, e.g. by the idle timeout.
+func isOutputAbort(err error) bool {
+	return errors.Is(err, ErrIdleTimeout) || errors.Is(err, ErrOutputRateExceeded)
+}
+
+// logger returns the logger set by WithLogger of the first stage having one, e.g. the logger of the task
+// running the pipeline, or the default logger.
+func (p *Pipeline) logger(ctx context.Context) *log.Entry {
+	for _, c := range p.commands {
+		if stage, ok := c.(*command); ok && stage.logEntry != nil {
+			return stage.logEntry.WithContext(ctx)
+		}
+	}
+	return log.WithContext(ctx)
+}
+
+// stages returns the commands of the pipeline checked by preflight.
+func (p *Pipeline) stages() ([]*command, error) {
+	if len(p.commands) == 0 {
+		return nil, errors.New("no command in pipeline")
+	}
+	stages := make([]*command, 0, len(p.commands))
+	for i, c := range p.commands {
+		stage, ok := c.(*command)
+		if !ok {
+			return nil, errors.Errorf("unsupported command type %T in pipeline", c)
+		}
+		if stage.idleTimeout > 0 && i < len(p.commands)-1 {
+			return nil, errors.Errorf("stage %s: idle timeout is only supported by the last stage", mask.Mask(stage.cmd))
+		}
+		// the timeout of the pipeline applies to the stages
+		copied := stage.runCopy()
+		copied.timeout = p.timeout
+		if err := copied.preflight(); err != nil {
+			return nil, errors.Wrapf(err, "stage %s", mask.Mask(stage.cmd))
+		}
+		stages = append(stages, copied)
+	}
+	return stages, nil
+}
+
+// start connects the stages by pipes and starts them in order. If any stage fails to start,
+// the started ones are killed. The copies of the pipes in the agent are closed once the stages are started,
+// so that each stage gets EOF or SIGPIPE when its neighbour exits.
+func (p *Pipeline) start(ctx context.Context, stages []*command, cmds []*exec.Cmd) ([]func(), []time.Time, error) {
+	var pipes []*os.File
+	defer func() {
+		for _, f := range pipes {
+			_ = f.Close()
+		}
+	}()
+	for i := 0; i < len(cmds)-1; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, nil, err
+		}
+		pipes = append(pipes, r, w)
+		cmds[i].Stdout = w
+		cmds[i+1].Stdin = r
+	}
+
+	releases := make([]func(), 0, len(cmds))
+	startedAt := make([]time.Time, 0, len(cmds))
+	for i, cmd := range cmds {
+		startedAt = append(startedAt, time.Now())
+		release, err := stages[i].startProcess(ctx, cmd)
+		if err != nil {
+			for j, started := range cmds[:i] {
+				_ = signalProcessGroup(started.Process, syscall.SIGKILL)
+				_ = started.Wait()
+				releases[j]()
+			}
+			return nil, nil, errors.Wrapf(err, "start stage %s", mask.Mask(stages[i].cmd))
+		}
+		releases = append(releases, release)
+	}
+	return releases, startedAt, nil
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline(t *testing.T) {
+	result, err := NewPipeline(
+		libShell.NewCommand("printf 'c\\nb\\na\\n'"),
+		libShell.NewCommand("sort"),
+		libShell.NewArgsCommand("head", "-n", "2"),
+	).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "a\nb\n", result.Output)
+	assert.Equal(t, []int{0, 0, 0}, result.ExitCodes)
+	assert.True(t, result.IsSuccessful())
+	assert.NoError(t, result.AsError())
+}
+
+func TestPipelineExitCodes(t *testing.T) {
+	result, err := NewPipeline(
+		libShell.NewCommand("echo a; exit 3"),
+		libShell.NewCommand("cat; echo oops >&2; exit 4"),
+		libShell.NewCommand("cat"),
+	).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 4, 0}, result.ExitCodes)
+	assert.Equal(t, 4, result.ExitCode())
+	assert.Equal(t, "oops\n", result.Stages[1].Stderr)
+	assert.Equal(t, "a\n", result.Output)
+	assert.Error(t, result.AsError())
+}
+
+func TestPipelineEarlyExit(t *testing.T) {
+	// head exits after the first line, yes is stopped by SIGPIPE instead of running forever
+	result, err := NewPipeline(libShell.NewArgsCommand("yes"), libShell.NewArgsCommand("head", "-n", "1")).
+		WithTimeout(5 * time.Second).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "y\n", result.Output)
+	assert.True(t, result.Stages[0].Signaled)
+}
+
+func TestPipelineTimeout(t *testing.T) {
+	start := time.Now()
+	result, err := NewPipeline(libShell.NewCommand("sleep 10"), libShell.NewCommand("cat")).
+		WithTimeout(time.Second).Execute()
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.NotNil(t, result)
+	assert.Equal(t, []int{-1, -1}, result.ExitCodes)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, err = NewPipeline(libShell.NewCommand("sleep 10"), libShell.NewCommand("cat")).WithContext(ctx).Execute()
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestPipelineError(t *testing.T) {
+	_, err := NewPipeline().Execute()
+	assert.Error(t, err)
+	_, err = NewPipeline(libShell.NewCommand("echo a"), libShell.NewCommand("cat").WithUser("obagent_not_exist_user")).Execute()
+	assert.Error(t, err)
+}
+
+func TestPipelineIdleTimeout(t *testing.T) {
+	start := time.Now()
+	result, err := NewPipeline(libShell.NewCommand("sleep 10"), libShell.NewCommand("cat").WithIdleTimeout(200*time.Millisecond)).
+		WithTimeout(5 * time.Second).Execute()
+	assert.True(t, errors.Is(err, ErrIdleTimeout))
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.NotNil(t, result)
+	assert.True(t, result.Stages[0].Killed)
+	assert.True(t, result.Stages[1].Killed)
+
+	// the stdout of the stages but the last is not watched
+	_, err = NewPipeline(libShell.NewCommand("sleep 10").WithIdleTimeout(time.Second), libShell.NewCommand("cat")).Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "only supported by the last stage")
+}
+
+func TestPipelineWithRunner(t *testing.T) {
+	SetRunner(DefaultRunner)
+	defer SetRunner(nil)
+	_, err := NewPipeline(libShell.NewCommand("echo a"), libShell.NewCommand("cat")).Execute()
+	assert.Error(t, err)
+}
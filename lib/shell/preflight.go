@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/oceanbase/obagent/lib/mask"
+)
+
+// preflight checks the command before starting it, so that a misconfiguration gets a descriptive error
+// instead of an opaque failure buried in the output.
+func (c *command) preflight() error {
+	if err := c.validateAllowlist(); err != nil {
+		return err
+	}
+	if err := c.validateChroot(); err != nil {
+		return err
+	}
+	if err := c.validateShell(); err != nil {
+		return err
+	}
+	if err := c.validateCredential(); err != nil {
+		return err
+	}
+	if err := c.resolveFallbackUser(); err != nil {
+		return err
+	}
+	if err := c.validateUser(); err != nil {
+		return err
+	}
+	if err := c.validateSwitchHelper(); err != nil {
+		return err
+	}
+	if err := c.validateScript(getCurrentUser()); err != nil {
+		return err
+	}
+	if err := c.validateCgroup(); err != nil {
+		return err
+	}
+	if err := c.validateUmask(); err != nil {
+		return err
+	}
+	return c.validateDir()
+}
+
+// Validate checks the command without running it, so that callers can find a misconfigured command at startup,
+// e.g. while validating the config, instead of at the first run. It checks the same as running the command does
+// before starting it: the shell, the user and the helper to switch to it, the working directory and so on.
+// In addition, the program of a command with args is looked up in PATH.
+func (c *command) Validate() error {
+	run := c.runCopy()
+	if err := run.preflight(); err != nil {
+		return errors.Wrapf(err, "invalid shell command %s", mask.Mask(c.cmd))
+	}
+	if err := run.validateProgram(); err != nil {
+		return errors.Wrapf(err, "invalid shell command %s", mask.Mask(c.cmd))
+	}
+	return nil
+}
+
+// validateProgram checks that the program of a command with args is installed.
+func (c *command) validateProgram() error {
+	// the program is inside the root directory, it can not be looked up in PATH of current process
+	if c.argv == nil || c.chroot != "" {
+		return nil
+	}
+	if _, err := exec.LookPath(c.argv[0]); err != nil {
+		return errors.Errorf("program %s not found: %s", c.argv[0], err)
+	}
+	return nil
+}
+
+// validateChroot checks that the root directory is valid and can be applied by current user.
+func (c *command) validateChroot() error {
+	if c.chroot == "" {
+		return nil
+	}
+	if !chrootSupported {
+		return errors.Errorf("can not run command in root directory %s: only supported on linux", c.chroot)
+	}
+	if currentUser := getCurrentUser(); currentUser != RootUser {
+		return errors.Errorf("can not run command in root directory %s: requires root, current user is %s", c.chroot, currentUser)
+	}
+	info, err := os.Stat(c.chroot)
+	if err != nil {
+		return errors.Errorf("invalid root directory %s: %s", c.chroot, err)
+	}
+	if !info.IsDir() {
+		return errors.Errorf("invalid root directory %s: not a directory", c.chroot)
+	}
+	return nil
+}
+
+// validateShell checks that the shell program to run the command is installed.
+// Commands with args run the program directly without a shell, they fail with a clear error anyway.
+func (c *command) validateShell() error {
+	// the program is inside the root directory, it can not be looked up in PATH of current process
+	if c.argv != nil || c.chroot != "" {
+		return nil
+	}
+	if _, err := exec.LookPath(string(c.program)); err != nil {
+		return errors.Errorf("shell %s not found in PATH, use %s instead", c.program, fallbackShell)
+	}
+	return nil
+}
+
+// validateCredential checks that the credential can be applied by current user.
+func (c *command) validateCredential() error {
+	if c.credential == nil {
+		return nil
+	}
+	if runtime.GOOS == "windows" {
+		return errors.New("can not run command with credential: not supported on windows")
+	}
+	if currentUser := getCurrentUser(); currentUser != RootUser {
+		return errors.Errorf("can not run command with credential: requires root, current user is %s", currentUser)
+	}
+	return nil
+}
+
+// validateUser checks that the user to run the command as exists, and can be switched to on this platform.
+func (c *command) validateUser() error {
+	if c.credential != nil || c.user == "" || c.user == getCurrentUser() {
+		return nil
+	}
+	if !userSwitchSupported {
+		return errors.Errorf("can not run command as user %s: not supported on %s", c.user, runtime.GOOS)
+	}
+	// sudo accepts "#uid" for a user not in the user database
+	if strings.HasPrefix(c.user, "#") {
+		return nil
+	}
+	if _, err := user.Lookup(c.user); err != nil {
+		if _, ok := err.(user.UnknownUserError); ok {
+			return errors.Errorf("invalid user %s: user does not exist", c.user)
+		}
+		// the user database can not be read, leave it to sudo or runuser
+		return nil
+	}
+	return nil
+}
+
+// resolveFallbackUser chooses the first existing one of the fallback users as the user of the command.
+func (c *command) resolveFallbackUser() error {
+	if len(c.fallbackUsers) == 0 {
+		return nil
+	}
+	currentUser := getCurrentUser()
+	if !userSwitchSupported {
+		// only current user can run the command
+		for _, candidate := range c.fallbackUsers {
+			if candidate == currentUser {
+				c.user = candidate
+				return nil
+			}
+		}
+		return errors.Errorf("can not run command as users %s: not supported on %s", strings.Join(c.fallbackUsers, ", "), runtime.GOOS)
+	}
+	for _, candidate := range c.fallbackUsers {
+		if candidate == currentUser || strings.HasPrefix(candidate, "#") {
+			c.user = candidate
+			return nil
+		}
+		if _, err := user.Lookup(candidate); err != nil {
+			if _, ok := err.(user.UnknownUserError); ok {
+				continue
+			}
+			// the user database can not be read, leave it to sudo or runuser
+		}
+		c.user = candidate
+		return nil
+	}
+	return errors.Errorf("invalid users %s: none of them exists", strings.Join(c.fallbackUsers, ", "))
+}
+
+// switchUserHelper returns the helper program to run a command as another user, runuser if current user is root,
+// otherwise sudo.
+func switchUserHelper(currentUser string) string {
+	if currentUser == RootUser {
+		return "runuser"
+	}
+	return "sudo"
+}
+
+// validateSwitchHelper checks that the helper to switch user is installed if the command runs as another user.
+func (c *command) validateSwitchHelper() error {
+	currentUser := getCurrentUser()
+	if c.credential != nil || c.user == "" || c.user == currentUser || !userSwitchSupported {
+		return nil
+	}
+	if err := lookPathHelper(switchUserHelper(currentUser)); err != nil {
+		return errors.Errorf("can not run command as user %s: %s", c.user, err)
+	}
+	return nil
+}
+
+// CanSwitchUser checks whether commands can be run as other users, i.e. the helper, runuser for root
+// or sudo for others, is installed. Callers can check it at startup instead of failing at the first command.
+func CanSwitchUser() error {
+	if !userSwitchSupported {
+		return errors.New("can not run command as other users: not supported on windows")
+	}
+	return lookPathHelper(switchUserHelper(getCurrentUser()))
+}
+
+func lookPathHelper(helper string) error {
+	if _, err := exec.LookPath(helper); err != nil {
+		return errors.Errorf("%s not found in PATH, install it or run the command as current user", helper)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"os/user"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateUser(t *testing.T) {
+	assert.NoError(t, (&command{user: getCurrentUser()}).validateUser())
+	if !userSwitchSupported {
+		// another user is rejected instead of running the command as current user
+		_, err := libShell.NewCommand("echo a").WithUser("admin").Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "can not run command as user admin: not supported on")
+		return
+	}
+
+	_, err := libShell.NewCommand("echo a").WithUser("obagent_not_exist_user").Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid user obagent_not_exist_user: user does not exist")
+
+	_, err = libShell.NewCommand("echo a").WithUser("obagent_not_exist_user").Start()
+	assert.Error(t, err)
+
+	assert.NoError(t, (&command{user: "#12345"}).validateUser())
+}
+
+func TestValidateSwitchHelper(t *testing.T) {
+	if _, err := user.Lookup("nobody"); err != nil {
+		t.Skip("user nobody not exists")
+	}
+	t.Setenv("PATH", t.TempDir())
+	_, err := libShell.NewCommand("echo a").WithShell(fallbackShell).WithUser("nobody").Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can not run command as user nobody")
+	assert.Contains(t, err.Error(), "not found in PATH")
+	assert.Error(t, CanSwitchUser())
+}
+
+func TestValidateShell(t *testing.T) {
+	_, err := libShell.NewCommand("echo a").WithShell("obagent_not_exist_shell").Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "shell obagent_not_exist_shell not found in PATH, use /bin/sh instead")
+
+	result, err := libShell.NewCommand("echo a").WithShell("/bin/sh").Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "a\n", result.Output)
+}
+
+func TestWithUserFallback(t *testing.T) {
+	currentUser := getCurrentUser()
+	result, err := libShell.NewCommand("echo a").WithUserFallback("obagent_not_exist_user", currentUser).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, currentUser, result.User)
+
+	_, err = libShell.NewCommand("echo a").WithUserFallback("obagent_not_exist_user", "obagent_not_exist_user2").Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid users obagent_not_exist_user, obagent_not_exist_user2: none of them exists")
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, libShell.NewCommand("echo a").Validate())
+	assert.NoError(t, libShell.NewArgsCommand("echo", "a").WithDir(t.TempDir()).Validate())
+
+	err := libShell.NewArgsCommand("obagent_not_exist_program", "a").Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "program obagent_not_exist_program not found")
+	err = libShell.NewCommand("echo a").WithShell("obagent_not_exist_shell").Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "shell obagent_not_exist_shell not found in PATH")
+	err = libShell.NewCommand("echo a").WithDir("/obagent_not_exist_dir").Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid working directory /obagent_not_exist_dir")
+
+	// the fallback user is resolved without changing the command
+	cmd := libShell.NewCommand("echo a").WithUserFallback("obagent_not_exist_user", getCurrentUser())
+	assert.NoError(t, cmd.Validate())
+	assert.Equal(t, "", cmd.User())
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+)
+
+// schedPriority is the scheduling priority of a command, each of them is not set if nil.
+type schedPriority struct {
+	nice   *int
+	ionice *ioPriority
+}
+
+type ioPriority struct {
+	class int
+	level int
+}
+
+// WithNice sets the nice value, from -20 (highest) to 19 (lowest), of the command and all its children,
+// so that a background command yields CPU to the database. It is best effort, failures are logged as warnings.
+func (c *command) WithNice(priority int) Command {
+	c.priority.nice = &priority
+	return c
+}
+
+// WithIONice sets the I/O scheduling class, 1 (realtime), 2 (best-effort) or 3 (idle),
+// and the level from 0 (highest) to 7 (lowest) of the command and all its children.
+// It is best effort and only supported on linux, failures are logged as warnings.
+func (c *command) WithIONice(class, level int) Command {
+	c.priority.ionice = &ioPriority{class: class, level: level}
+	return c
+}
+
+// applyPriority applies the scheduling priority to the process group led by pid, right after the process starts.
+// Processes forked later inherit the priority.
+func (c *command) applyPriority(ctx context.Context, pid int) {
+	if c.priority.nice != nil {
+		if err := setNice(pid, *c.priority.nice); err != nil {
+			c.logger(ctx).Warnf("set nice of shell command failed, command=%s, nice=%d, error=%s", c.String(), *c.priority.nice, err)
+		}
+	}
+	if ionice := c.priority.ionice; ionice != nil {
+		if err := setIONice(pid, ionice.class, ionice.level); err != nil {
+			c.logger(ctx).Warnf("set ionice of shell command failed, command=%s, class=%d, level=%d, error=%s", c.String(), ionice.class, ionice.level, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"syscall"
+)
+
+const (
+	ioprioWhoPgrp    = 2
+	ioprioClassShift = 13
+)
+
+// setNice sets the nice value of the process group led by pid.
+func setNice(pid int, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PGRP, pid, nice)
+}
+
+// setIONice sets the I/O scheduling class and level of the process group led by pid by ioprio_set.
+func setIONice(pid int, class, level int) error {
+	ioprio := class<<ioprioClassShift | level
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoPgrp, uintptr(pid), uintptr(ioprio)); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+//go:build !linux
+// +build !linux
+
+package shell
+
+import "errors"
+
+var errPriorityNotSupported = errors.New("only supported on linux")
+
+func setNice(pid int, nice int) error {
+	return errPriorityNotSupported
+}
+
+func setIONice(pid int, class, level int) error {
+	return errPriorityNotSupported
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oceanbase/obagent/lib/mask"
+	agentlog "github.com/oceanbase/obagent/log"
+)
+
+// Process is a handle of a command running in background, started by Command.Start.
+type Process struct {
+	cmd    *exec.Cmd
+	done   chan struct{}
+	result *ExecuteResult
+	err    error
+}
+
+// Start starts the command in background and returns without waiting for it.
+// The timeout and idle timeout of the command do not apply, the process runs until it exits, gets killed,
+// or the context of the command is done. The process is the leader of a new process group,
+// so that Kill also kills its children.
+func (c *command) Start() (*Process, error) {
+	c = c.runCopy()
+	parent := c.context
+	if parent == nil {
+		parent = context.Background()
+	}
+	c.applyDefaults(parent)
+	ctx := context.WithValue(parent, agentlog.StartTimeKey, time.Now())
+	c.logger(ctx).Infof("start shell command, command=%s", c.String())
+	if err := c.preflight(); err != nil {
+		c.logger(ctx).Errorf("start shell command error, command=%s, error=%s", c.String(), err)
+		return nil, errors.Wrapf(err, "error when start shell command %s", mask.Mask(c.cmd))
+	}
+	run, removeScript, err := c.prepareScript()
+	if err != nil {
+		c.logger(ctx).Errorf("start shell command error, command=%s, error=%s", c.String(), err)
+		return nil, errors.Errorf("error when start shell command %s: %s", mask.Mask(c.cmd), err)
+	}
+	cmd := run.newExecCmd()
+	capture := c.newOutputCapture()
+	cmd.Stdout = capture.stdoutWriter()
+	cmd.Stderr = capture.stderrWriter()
+	startedAt := time.Now()
+	releaseProcess, err := c.startProcess(ctx, cmd)
+	if err != nil {
+		removeScript()
+		c.logger(ctx).Errorf("start shell command error, command=%s, error=%s", c.String(), err)
+		return nil, errors.Errorf("error when start shell command %s: %s", mask.Mask(c.cmd), err)
+	}
+	p := &Process{
+		cmd:  cmd,
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(p.done)
+		defer removeScript()
+		err := waitCommand(ctx, cmd, 0, nil, c.terminatePolicy())
+		releaseProcess()
+		p.result, p.err = c.newExecuteResult(ctx, info, capture, cmd, startedAt, err)
+		c.observeMetrics(p.result, p.err)
+	}()
+	return p, nil
+}
+
+// Pid returns the process id.
+func (p *Process) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+// Wait waits for the process to exit and returns the result like ExecuteAllowFailure.
+// It is safe to call Wait more than once and from multiple goroutines.
+func (p *Process) Wait() (*ExecuteResult, error) {
+	<-p.done
+	return p.result, p.err
+}
+
+// Done returns a channel that is closed when the process exits.
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Signal sends the signal to the process group of the process.
+// It returns os.ErrProcessDone if the process has exited.
+func (p *Process) Signal(sig os.Signal) error {
+	select {
+	case <-p.done:
+		return os.ErrProcessDone
+	default:
+	}
+	if s, ok := sig.(syscall.Signal); ok {
+		return signalProcessGroup(p.cmd.Process, s)
+	}
+	return p.cmd.Process.Signal(sig)
+}
+
+// Reload sends SIGHUP to the process group, which makes processes like observer reload their config.
+// It is not supported on windows, where it would kill the process instead.
+func (p *Process) Reload() error {
+	if !signalSupported {
+		return errors.New("reload by signal is not supported on " + runtime.GOOS)
+	}
+	return p.Signal(syscall.SIGHUP)
+}
+
+// Terminate sends SIGTERM to the process group, to let the process exit gracefully.
+// Use Wait or Done to wait for the exit, and Kill if it does not exit in time.
+// It kills the process on windows, and returns nil if the process has exited, like Kill.
+func (p *Process) Terminate() error {
+	err := p.Signal(syscall.SIGTERM)
+	if err == os.ErrProcessDone {
+		return nil
+	}
+	return err
+}
+
+// Kill kills the process together with its children.
+func (p *Process) Kill() error {
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	return p.Signal(syscall.SIGKILL)
+}
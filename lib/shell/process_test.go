@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartWait(t *testing.T) {
+	p, err := libShell.NewCommand("echo a; exit 2").Start()
+	require.NoError(t, err)
+	assert.True(t, p.Pid() > 0)
+	result, err := p.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.ExitCode)
+	assert.Equal(t, "a\n", result.Output)
+
+	// wait again returns the same result
+	result2, err := p.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, result, result2)
+}
+
+func TestStartKill(t *testing.T) {
+	p, err := libShell.NewCommand("sleep 30 & sleep 30; wait").Start()
+	require.NoError(t, err)
+	require.NoError(t, p.Kill())
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("process not killed")
+	}
+	result, _ := p.Wait()
+	require.NotNil(t, result)
+	assert.False(t, result.IsSuccessful())
+}
+
+func TestStartReloadTerminate(t *testing.T) {
+	if !signalSupported {
+		t.Skip("signals are not supported")
+	}
+	p, err := libShell.NewCommand("trap 'echo reloaded' HUP; trap 'echo terminated; exit 0' TERM; echo ready; while true; do sleep 0.05; done").
+		Start()
+	require.NoError(t, err)
+	// give the shell time to set the traps
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, p.Reload())
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, p.Terminate())
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		require.NoError(t, p.Kill())
+		t.Fatal("process not terminated")
+	}
+	result, err := p.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.ExitCode)
+	// the signals go to the sleep children too, which makes the shell report them
+	assert.Contains(t, result.Lines(), "reloaded")
+	assert.Contains(t, result.Lines(), "terminated")
+
+	// signaling an exited process
+	assert.NoError(t, p.Terminate())
+	assert.Equal(t, os.ErrProcessDone, p.Reload())
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import "strings"
+
+// name returns the name of the program without the directory and the .exe suffix, in lower case, e.g. powershell.
+func (p Program) name() string {
+	s := string(p)
+	if i := strings.LastIndexAny(s, `/\`); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSuffix(strings.ToLower(s), ".exe")
+}
+
+// commandArgs returns the args of the program to run cmd, e.g. -c cmd for sh, /C cmd for cmd.
+func (p Program) commandArgs(cmd string) []string {
+	switch p.name() {
+	case string(Cmd):
+		return []string{"/C", cmd}
+	case string(PowerShell), string(Pwsh):
+		return []string{"-NoProfile", "-NonInteractive", "-Command", cmd}
+	default:
+		return []string{"-c", cmd}
+	}
+}
+
+// scriptArgs returns the args of the program to run the script file at path.
+func (p Program) scriptArgs(path string) []string {
+	switch p.name() {
+	case string(Cmd):
+		return []string{"/C", path}
+	case string(PowerShell), string(Pwsh):
+		return []string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", path}
+	default:
+		return []string{path}
+	}
+}
+
+// scriptExt returns the extension of script files run by the program, cmd and powershell only run files by extension.
+func (p Program) scriptExt() string {
+	switch p.name() {
+	case string(Cmd):
+		return ".bat"
+	case string(PowerShell), string(Pwsh):
+		return ".ps1"
+	default:
+		return ".sh"
+	}
+}
@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgramArgs(t *testing.T) {
+	assert.Equal(t, []string{"-c", "echo a"}, Bash.commandArgs("echo a"))
+	assert.Equal(t, []string{"-c", "echo a"}, Program("/bin/sh").commandArgs("echo a"))
+	assert.Equal(t, []string{"/C", "echo a"}, Cmd.commandArgs("echo a"))
+	assert.Equal(t, []string{"/C", "echo a"}, Program(`C:\Windows\System32\CMD.EXE`).commandArgs("echo a"))
+	assert.Equal(t, []string{"-NoProfile", "-NonInteractive", "-Command", "Get-Date"}, PowerShell.commandArgs("Get-Date"))
+	assert.Equal(t, []string{"-NoProfile", "-NonInteractive", "-Command", "Get-Date"}, Program("pwsh.exe").commandArgs("Get-Date"))
+
+	assert.Equal(t, []string{"/tmp/a.sh"}, Sh.scriptArgs("/tmp/a.sh"))
+	assert.Equal(t, ".sh", Zsh.scriptExt())
+	assert.Equal(t, []string{"/C", `C:\Temp\a.bat`}, Cmd.scriptArgs(`C:\Temp\a.bat`))
+	assert.Equal(t, ".bat", Cmd.scriptExt())
+	assert.Equal(t, "-File", PowerShell.scriptArgs(`C:\Temp\a.ps1`)[4])
+	assert.Equal(t, ".ps1", Pwsh.scriptExt())
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteArg(t *testing.T) {
+	assert.Equal(t, `'it'\''s'`, QuoteArg("it's"))
+	assert.Equal(t, `''`, QuoteArg(""))
+
+	values := []string{"it's", "'", "a b  c", "line1\nline2", "`id`", "$(id) $HOME", `back\slash "double"`, "a; rm -rf /tmp/obagent_not_exist"}
+	for _, value := range values {
+		result, err := libShell.NewCommand("printf '%s' " + QuoteArg(value)).Execute()
+		require.NoError(t, err)
+		assert.Equal(t, value, result.Output)
+	}
+}
+
+func TestQuoteArgs(t *testing.T) {
+	assert.Equal(t, `'a b' 'it'\''s' ''`, QuoteArgs([]string{"a b", "it's", ""}))
+	assert.Equal(t, "", QuoteArgs(nil))
+
+	args := []string{"a b", "it's", "line1\nline2", "`id`"}
+	result, err := libShell.NewCommand("printf '%s|' " + QuoteArgs(args)).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, strings.Join(args, "|")+"|", result.Output)
+}
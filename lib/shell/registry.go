@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oceanbase/obagent/lib/mask"
+	agentlog "github.com/oceanbase/obagent/log"
+)
+
+// CommandInfo describes a running command, see ActiveCommands.
+type CommandInfo struct {
+	Command   string    `json:"command"` // masked
+	User      string    `json:"user"`    // empty means current user
+	Pid       int       `json:"pid"`
+	StartedAt time.Time `json:"startedAt"`
+	TraceId   string    `json:"traceId"` // trace id of the context of the command, e.g. of the API request running it
+}
+
+// activeCommands keeps the commands running, registered once their processes start.
+var activeCommands = commandRegistry{commands: make(map[int64]CommandInfo)}
+
+type commandRegistry struct {
+	mu       sync.Mutex
+	nextId   int64
+	commands map[int64]CommandInfo
+}
+
+// register adds the command, it returns a function to remove it once the process exits.
+func (r *commandRegistry) register(info CommandInfo) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextId++
+	id := r.nextId
+	r.commands[id] = info
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.commands, id)
+	}
+}
+
+// ActiveCommands returns the commands running now in the order they are started,
+// including the ones of pipelines, streams and background processes started by Start, but not daemons.
+func ActiveCommands() []CommandInfo {
+	activeCommands.mu.Lock()
+	defer activeCommands.mu.Unlock()
+	infos := make([]CommandInfo, 0, len(activeCommands.commands))
+	for _, info := range activeCommands.commands {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].StartedAt.Before(infos[j].StartedAt)
+	})
+	return infos
+}
+
+// registerActive registers the started command as active.
+func (c *command) registerActive(ctx context.Context, pid int) func() {
+	traceId, _ := ctx.Value(agentlog.TraceIdKey{}).(string)
+	return activeCommands.register(CommandInfo{
+		Command:   mask.Mask(c.cmd),
+		User:      c.user,
+		Pid:       pid,
+		StartedAt: time.Now(),
+		TraceId:   traceId,
+	})
+}
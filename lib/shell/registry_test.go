@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	agentlog "github.com/oceanbase/obagent/log"
+)
+
+func TestActiveCommands(t *testing.T) {
+	ctx := context.WithValue(context.Background(), agentlog.TraceIdKey{}, "trace-1")
+	p, err := libShell.NewCommand("sleep 0.3; echo password=secret").WithContext(ctx).Start()
+	require.NoError(t, err)
+
+	var found *CommandInfo
+	for _, info := range ActiveCommands() {
+		if info.Pid == p.Pid() {
+			info := info
+			found = &info
+		}
+	}
+	require.NotNil(t, found)
+	assert.Equal(t, "sleep 0.3; echo password=xxx", found.Command)
+	assert.Equal(t, "trace-1", found.TraceId)
+	assert.False(t, found.StartedAt.IsZero())
+
+	_, err = p.Wait()
+	require.NoError(t, err)
+	for _, info := range ActiveCommands() {
+		assert.NotEqual(t, p.Pid(), info.Pid)
+	}
+}
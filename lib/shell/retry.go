@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type retryPolicy struct {
+	attempts    int           // max times to run the command, including the first one
+	backoff     time.Duration // sleep time between two attempts
+	exponential bool          // double the backoff after each attempt
+	exitCodes   []int         // retry only on these exit codes if provided, otherwise retry on any non-zero exit code
+	hook        RetryHook     // called before sleeping for each retry if not nil
+}
+
+// RetryHook is called by ExecuteWithRetry before sleeping for a retry, with the number of the failed attempt
+// from 1, the result of it, and the backoff to sleep before the next attempt.
+type RetryHook func(attempt int, last *ExecuteResult, backoff time.Duration)
+
+// WithRetry makes ExecuteWithRetry run the command up to attempts times, sleeping backoff between two attempts.
+func (c *command) WithRetry(attempts int, backoff time.Duration) Command {
+	c.retry.attempts = attempts
+	c.retry.backoff = backoff
+	return c
+}
+
+// WithExponentialBackoff doubles the retry backoff after each attempt.
+func (c *command) WithExponentialBackoff() Command {
+	c.retry.exponential = true
+	return c
+}
+
+// WithRetryExitCodes makes ExecuteWithRetry retry only when the command exits with one of the given codes.
+// Timeouts are always retried.
+func (c *command) WithRetryExitCodes(exitCodes ...int) Command {
+	c.retry.exitCodes = exitCodes
+	return c
+}
+
+// WithRetryHook makes ExecuteWithRetry call hook for each retry before sleeping, e.g. to log or count retries.
+// It is not called for the last attempt, whose result is returned.
+func (c *command) WithRetryHook(hook RetryHook) Command {
+	c.retry.hook = hook
+	return c
+}
+
+// ExecuteWithRetry executes the command like Execute, and re-runs it on timeout or non-zero exit code
+// according to the retry policy. The result of the last attempt is returned.
+func (c *command) ExecuteWithRetry() (*ExecuteResult, error) {
+	ctx := c.context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	attempts := c.retry.attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := c.retry.backoff
+	for attempt := 1; ; attempt++ {
+		executeResult, err := c.execute(ctx, info)
+		retry := false
+		if err != nil {
+			// errors other than timeout, e.g. cancellation, are not transient
+			retry = errors.Is(err, ErrCommandTimeout) || errors.Is(err, ErrIdleTimeout)
+		} else if err = executeResult.AsError(); err != nil {
+			retry = c.retry.retryOnExitCode(executeResult.ExitCode)
+		}
+		if !retry || attempt >= attempts {
+			return executeResult, err
+		}
+		c.logger(ctx).Infof("execute shell command failed, retry after %s, command=%s, attempt=%d, error=%s", backoff, c.String(), attempt, err)
+		if c.retry.hook != nil {
+			c.retry.hook(attempt, executeResult, backoff)
+		}
+		select {
+		case <-ctx.Done():
+			return executeResult, errors.Wrapf(ctx.Err(), "retry shell command %s cancelled", c.String())
+		case <-time.After(backoff):
+		}
+		if c.retry.exponential {
+			backoff *= 2
+		}
+	}
+}
+
+func (p retryPolicy) retryOnExitCode(exitCode int) bool {
+	if len(p.exitCodes) == 0 {
+		return true
+	}
+	for _, code := range p.exitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+	return false
+}
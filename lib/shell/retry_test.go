@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// counterCommand returns a command that exits with exitCode until it has run succeedAt times.
+func counterCommand(t *testing.T, succeedAt int, exitCode int) string {
+	counter := filepath.Join(t.TempDir(), "counter")
+	return fmt.Sprintf("echo x >> %s; n=$(wc -l < %s); echo $n; [ $n -ge %d ] || exit %d", counter, counter, succeedAt, exitCode)
+}
+
+func TestExecuteWithRetry(t *testing.T) {
+	result, err := libShell.NewCommand(counterCommand(t, 3, 1)).WithRetry(3, 10*time.Millisecond).ExecuteWithRetry()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3"}, result.Lines())
+
+	result, err = libShell.NewCommand(counterCommand(t, 3, 1)).WithRetry(2, 10*time.Millisecond).WithExponentialBackoff().ExecuteWithRetry()
+	assert.Error(t, err)
+	assert.Equal(t, 1, result.ExitCode)
+	assert.Equal(t, []string{"2"}, result.Lines())
+}
+
+func TestExecuteWithRetryExitCodes(t *testing.T) {
+	result, err := libShell.NewCommand(counterCommand(t, 3, 2)).WithRetry(3, 10*time.Millisecond).WithRetryExitCodes(1).ExecuteWithRetry()
+	assert.Error(t, err)
+	assert.Equal(t, 2, result.ExitCode)
+	assert.Equal(t, []string{"1"}, result.Lines())
+
+	result, err = libShell.NewCommand(counterCommand(t, 3, 2)).WithRetry(3, 10*time.Millisecond).WithRetryExitCodes(1, 2).ExecuteWithRetry()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3"}, result.Lines())
+}
+
+func TestExecuteWithRetryHook(t *testing.T) {
+	var attempts []int
+	var backoffs []time.Duration
+	hook := func(attempt int, last *ExecuteResult, backoff time.Duration) {
+		require.NotNil(t, last)
+		assert.Equal(t, []string{fmt.Sprint(attempt)}, last.Lines())
+		attempts = append(attempts, attempt)
+		backoffs = append(backoffs, backoff)
+	}
+	result, err := libShell.NewCommand(counterCommand(t, 3, 1)).WithRetry(3, 10*time.Millisecond).WithExponentialBackoff().
+		WithRetryHook(hook).ExecuteWithRetry()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3"}, result.Lines())
+	assert.Equal(t, []int{1, 2}, attempts)
+	assert.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}, backoffs)
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// Runner runs commands for Execute and its variants, so that tests of code running commands can replace
+// spawning processes by a fake returning canned results, see SetRunner.
+type Runner interface {
+	// Run runs cmd until it exits or ctx is done. Like ExecuteAllowFailure, a command exiting with a non-zero code
+	// is not an error, Execute returns the AsError of the result for it.
+	Run(ctx context.Context, cmd Command) (*ExecuteResult, error)
+}
+
+// RunnerFunc is a function used as a Runner.
+type RunnerFunc func(ctx context.Context, cmd Command) (*ExecuteResult, error)
+
+func (f RunnerFunc) Run(ctx context.Context, cmd Command) (*ExecuteResult, error) {
+	return f(ctx, cmd)
+}
+
+// DefaultRunner runs commands by spawning processes, as Execute does without a runner set.
+// A fake runner can delegate the commands it does not handle to it.
+var DefaultRunner Runner = RunnerFunc(func(ctx context.Context, cmd Command) (*ExecuteResult, error) {
+	c, ok := cmd.(*command)
+	if !ok {
+		return nil, errors.Errorf("unsupported command type %T", cmd)
+	}
+	return c.spawn(ctx, info)
+})
+
+// runnerHolder holds the runner set by SetRunner, as atomic.Value can not hold nil.
+type runnerHolder struct {
+	runner Runner
+}
+
+var customRunner atomic.Value
+
+// SetRunner makes Execute and its variants, including retries and ExecuteJSON, run commands by runner
+// instead of spawning processes. nil restores the default. It is meant for tests, and applies to all commands,
+// so tests setting it should not run in parallel. Streams emit the lines of the output of the results of runner.
+// Background processes are not affected, and pipelines fail while it is set, as their stages can not be run separately.
+func SetRunner(runner Runner) {
+	customRunner.Store(runnerHolder{runner: runner})
+}
+
+// currentRunner returns the runner set by SetRunner, or nil if it is not set.
+func currentRunner() Runner {
+	holder, _ := customRunner.Load().(runnerHolder)
+	return holder.runner
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetRunner(t *testing.T) {
+	var commands []string
+	SetRunner(RunnerFunc(func(ctx context.Context, cmd Command) (*ExecuteResult, error) {
+		commands = append(commands, cmd.Cmd())
+		switch cmd.Cmd() {
+		case "cat /proc/loadavg":
+			return &ExecuteResult{Command: cmd.Cmd(), Output: "0.10 0.20 0.30 1/100 12345\n"}, nil
+		case "systemctl is-active obagent":
+			return &ExecuteResult{Command: cmd.Cmd(), ExitCode: 3, Output: "inactive\n"}, nil
+		}
+		return DefaultRunner.Run(ctx, cmd)
+	}))
+	defer SetRunner(nil)
+
+	result, err := libShell.NewCommand("cat /proc/loadavg").Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "0.10 0.20 0.30 1/100 12345\n", result.Output)
+
+	// a non-zero exit code is an error of Execute, but not of ExecuteAllowFailure
+	_, err = libShell.NewCommand("systemctl is-active obagent").Execute()
+	assert.Error(t, err)
+	result, err = libShell.NewCommand("systemctl is-active obagent").ExecuteAllowFailure()
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+
+	// other commands are delegated to the default runner
+	result, err = libShell.NewCommand("echo real").Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "real\n", result.Output)
+	assert.Equal(t, []string{"cat /proc/loadavg", "systemctl is-active obagent", "systemctl is-active obagent", "echo real"}, commands)
+
+	SetRunner(nil)
+	result, err = libShell.NewCommand("echo real").Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "real\n", result.Output)
+	assert.Len(t, commands, 4)
+}
@@ -0,0 +1,33 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"os"
+	"time"
+)
+
+// Rusage is the resource usage of a finished command, including its waited-for children.
+type Rusage struct {
+	UserTime   time.Duration // user CPU time
+	SystemTime time.Duration // system CPU time
+	MaxRSS     int64         // max resident set size in bytes, 0 if not supported on the platform
+}
+
+func newRusage(state *os.ProcessState) *Rusage {
+	return &Rusage{
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+		MaxRSS:     maxRSS(state),
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// NewScript creates a command that writes content to a temp file and runs it with the program,
+// instead of passing it by -c, so that a long multi-line script needs no quoting.
+// The file is only accessible by the user running it, and is removed after the command exits.
+// A script can only run as another user, except root, if the agent runs as root, see validateScript.
+func (s ShellImpl) NewScript(content string) Command {
+	return &command{
+		program:    defaultProgram,
+		outputType: DefaultOutputType,
+		cmd:        content,
+		script:     true,
+	}
+}
+
+// prepareScript writes the script of the command to a temp file, and returns a copy of the command
+// running the file and a function to remove it. The command itself is returned if it is not a script.
+func (c *command) prepareScript() (*command, func(), error) {
+	if !c.script {
+		return c, func() {}, nil
+	}
+	// the script must be inside the root directory of the command
+	tempDir := os.TempDir()
+	f, err := os.CreateTemp(filepath.Join(c.chroot, tempDir), "obagent-script-*"+c.program.scriptExt())
+	if err != nil {
+		return nil, func() {}, errors.Errorf("create script file failed: %s", err)
+	}
+	path := f.Name()
+	remove := func() {
+		_ = os.Remove(path)
+	}
+	_, err = f.WriteString(c.cmd)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(path, 0700)
+	}
+	if err == nil {
+		err = c.chownScript(path)
+	}
+	if err != nil {
+		remove()
+		return nil, func() {}, errors.Errorf("write script file %s failed: %s", path, err)
+	}
+	run := *c
+	run.argv = append([]string{string(c.program)}, c.program.scriptArgs(filepath.Join(tempDir, filepath.Base(path)))...)
+	return &run, remove, nil
+}
+
+// validateScript checks that the script file can be handed to the user running it. The file is only accessible
+// by its owner, and only root can change the owner to another user, so a script can not run as another user,
+// except root, if the agent is not run by root.
+func (c *command) validateScript(currentUser string) error {
+	if !c.script || currentUser == RootUser {
+		return nil
+	}
+	if c.credential != nil && int(c.credential.Uid) != os.Getuid() {
+		return errors.Errorf("can not run script as uid %d: only supported if the agent runs as root", c.credential.Uid)
+	}
+	if c.user != "" && c.user != RootUser && c.user != currentUser && userSwitchSupported {
+		return errors.Errorf("can not run script as user %s: only supported if the agent runs as root", c.user)
+	}
+	return nil
+}
+
+// chownScript makes the script file owned by the user to run it, root can read it anyway.
+func (c *command) chownScript(path string) error {
+	if c.credential != nil {
+		return os.Chown(path, int(c.credential.Uid), int(c.credential.Gid))
+	}
+	if c.user == "" || c.user == RootUser || c.user == getCurrentUser() || !userSwitchSupported {
+		return nil
+	}
+	u, err := user.Lookup(c.user)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return err
+	}
+	return os.Chown(path, uid, gid)
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testScript = `#!/bin/sh
+# quotes need no escaping in a script
+echo "it's a \"script\""
+echo $0
+`
+
+func TestNewScript(t *testing.T) {
+	result, err := libShell.NewScript(testScript).Execute()
+	require.NoError(t, err)
+	lines := result.Lines()
+	require.Len(t, lines, 2)
+	assert.Equal(t, `it's a "script"`, lines[0])
+	// the script file is removed after execution
+	_, err = os.Stat(lines[1])
+	assert.True(t, os.IsNotExist(err))
+
+	result, err = libShell.NewScript("echo $0; exit 3").ExecuteAllowFailure()
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+	_, err = os.Stat(result.Lines()[0])
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestNewScriptTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lines, errCh := libShell.NewScript("echo $0; sleep 10").ExecuteStream(ctx)
+	path := <-lines
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	cancel()
+	assert.True(t, errors.Is(<-errCh, context.Canceled))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	if testing.Short() {
+		return
+	}
+	result, err := libShell.NewScript("echo $0; sleep 10").WithTimeout(time.Second).Execute()
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	require.NotNil(t, result)
+	_, err = os.Stat(result.Lines()[0])
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestNewScriptAsUser(t *testing.T) {
+	// only root can hand the script file to another user
+	c := libShell.NewScript("id -un").WithUser("admin").(*command)
+	assert.NoError(t, c.validateScript(RootUser))
+	if userSwitchSupported {
+		err := c.validateScript("obagent")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "only supported if the agent runs as root")
+	}
+	assert.NoError(t, c.validateScript("admin"))
+	assert.NoError(t, libShell.NewScript("id -un").WithUser(RootUser).(*command).validateScript("obagent"))
+	assert.NoError(t, libShell.NewCommand("id -un").WithUser("admin").(*command).validateScript("obagent"))
+}
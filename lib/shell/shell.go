@@ -14,6 +14,8 @@ package shell
 
 type Shell interface {
 	NewCommand(cmd string) Command
+	NewArgsCommand(program string, args ...string) Command
+	NewScript(content string) Command
 }
 
 type ShellImpl struct {
@@ -21,9 +23,20 @@ type ShellImpl struct {
 
 func (s ShellImpl) NewCommand(cmd string) Command {
 	return &command{
-		program:    DefaultProgram,
+		program:    defaultProgram,
 		outputType: DefaultOutputType,
 		cmd:        cmd,
-		timeout:    DefaultTimeout,
+	}
+}
+
+// NewArgsCommand creates a command that runs program with args directly, without a shell.
+// Each arg is passed to the program literally, so it is safe to contain user-supplied values.
+func (s ShellImpl) NewArgsCommand(program string, args ...string) Command {
+	argv := append([]string{program}, args...)
+	return &command{
+		program:    Program(program),
+		outputType: DefaultOutputType,
+		cmd:        QuoteArgs(argv),
+		argv:       argv,
 	}
 }
@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oceanbase/obagent/lib/mask"
+	agentlog "github.com/oceanbase/obagent/log"
+)
+
+// ExecuteStream starts the command and emits each line of its stdout as soon as it is produced.
+// The lines channel is closed when the process exits. The error channel then receives exactly one value:
+// nil on success, the AsError of the result on a non-zero exit, ErrCommandTimeout on timeout, or ctx.Err() if ctx is done.
+// The process is terminated when ctx is done, the command times out, or a line exceeds the max bytes of WithMaxLineBytes,
+// which fails the stream with an error wrapping bufio.ErrTooLong.
+// Like Execute, the stream waits for a slot of SetMaxConcurrent before starting, fails after Shutdown is called,
+// and is run by the runner set by SetRunner if any, then the lines of the output of the result are emitted.
+// Lines are masked like the output of Execute, unless disabled by WithOutputMasking.
+// The caller must read lines until the channel is closed, or cancel ctx to stop early, the process is blocked
+// while a line is not read. So the lifetime of a stream without timeout, see WithNoTimeout, is bound to ctx,
+// and it fails if ctx can never be done.
+func (c *command) ExecuteStream(ctx context.Context) (<-chan string, <-chan error) {
+	lines := make(chan string)
+	errCh := make(chan error, 1)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if runner := currentRunner(); runner != nil {
+		go runStream(ctx, runner, c, lines, errCh)
+		return lines, errCh
+	}
+	c = c.runCopy()
+	c.applyDefaults(ctx)
+	ctx = context.WithValue(ctx, agentlog.StartTimeKey, time.Now())
+	c.logger(ctx).Infof("execute shell command stream start, command=%s", c.String())
+
+	err := c.preflight()
+	if err == nil && c.Timeout() <= 0 && ctx.Done() == nil {
+		err = errors.New("stream without timeout requires a context that can be cancelled")
+	}
+	run, removeScript := c, func() {}
+	if err == nil {
+		run, removeScript, err = c.prepareScript()
+	}
+	var cmd *exec.Cmd
+	var stdout io.ReadCloser
+	releaseSlot, releaseProcess := func() {}, func() {}
+	if err == nil {
+		var release func()
+		if release, err = concurrencyLimiter.acquire(ctx); err == nil {
+			releaseSlot = release
+		}
+	}
+	if err == nil {
+		cmd = run.newExecCmd()
+		stdout, err = cmd.StdoutPipe()
+	}
+	if err == nil {
+		releaseProcess, err = c.startProcess(ctx, cmd)
+	}
+	if err != nil {
+		releaseSlot()
+		removeScript()
+		c.logger(ctx).Errorf("execute shell command stream error, command=%s, error=%s", c.String(), err)
+		close(lines)
+		errCh <- errors.Wrapf(err, "error when execute shell command %s", mask.Mask(c.cmd))
+		close(errCh)
+		return lines, errCh
+	}
+
+	go func() {
+		defer close(errCh)
+		defer close(lines)
+		defer removeScript()
+		defer releaseSlot()
+		untrack := concurrencyLimiter.track(cmd.Process, nil)
+
+		// the watcher kills the process on timeout, cancellation or failure of the scanner, which unblocks it below
+		done := make(chan struct{})
+		scanFailed := make(chan struct{})
+		stopped := make(chan struct{})
+		watcherExited := make(chan struct{})
+		var stopErr error
+		go func() {
+			defer close(watcherExited)
+			var timeoutCh <-chan time.Time
+			if timeout := c.Timeout(); timeout > 0 {
+				timer := time.NewTimer(timeout)
+				defer timer.Stop()
+				timeoutCh = timer.C
+			}
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				stopErr = ctx.Err()
+			case <-timeoutCh:
+				stopErr = ErrCommandTimeout
+			case <-scanFailed:
+			}
+			close(stopped)
+			c.terminatePolicy().terminate(ctx, cmd, done)
+		}()
+
+		scanner := bufio.NewScanner(stdout)
+		maxLineBytes := c.maxLineBytes
+		if maxLineBytes <= 0 {
+			maxLineBytes = defaultMaxLineBytes
+		}
+		scanner.Buffer(nil, maxLineBytes)
+	scan:
+		for scanner.Scan() {
+			line := c.decodeOutput(scanner.Text())
+			if c.stripANSI {
+				line = StripANSI(line)
+			}
+			select {
+			case lines <- c.maskLine(ctx, line):
+			case <-stopped:
+				break scan
+			}
+		}
+		scanErr := scanner.Err()
+		if scanErr != nil {
+			close(scanFailed)
+		}
+		// drain the pipe so that Wait does not close it while the process is still writing
+		_, _ = io.Copy(ioutil.Discard, stdout)
+		waitErr := cmd.Wait()
+		untrack()
+		releaseProcess()
+		close(done)
+		<-watcherExited
+
+		errCh <- c.streamError(ctx, stopErr, waitErr, scanErr)
+	}()
+	return lines, errCh
+}
+
+// runStream runs the command by runner and emits the lines of its output, see ExecuteStream.
+func runStream(ctx context.Context, runner Runner, c *command, lines chan<- string, errCh chan<- error) {
+	defer close(errCh)
+	defer close(lines)
+	result, err := runner.Run(ctx, c)
+	if result != nil && result.Output != "" {
+		for _, line := range strings.Split(strings.TrimSuffix(result.Output, "\n"), "\n") {
+			select {
+			case lines <- c.maskLine(ctx, line):
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+		}
+	}
+	if err == nil && result != nil {
+		err = result.AsError()
+	}
+	errCh <- err
+}
+
+// maskLine masks the secrets in a line of the output, unless disabled by WithOutputMasking.
+func (c *command) maskLine(ctx context.Context, line string) string {
+	if c.noOutputMasking {
+		return line
+	}
+	return mask.MaskFromContext(ctx, line)
+}
+
+// ExecuteForEachLine executes the command and calls fn for each line of its stdout as soon as it is produced.
+// If fn returns an error, the process is killed and the error is returned. Otherwise it returns the error
+// of the stream like ExecuteStream.
+func (c *command) ExecuteForEachLine(ctx context.Context, fn func(line string) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lines, errCh := c.ExecuteStream(ctx)
+	var fnErr error
+	for line := range lines {
+		if fnErr != nil {
+			continue
+		}
+		if fnErr = fn(line); fnErr != nil {
+			cancel()
+		}
+	}
+	err := <-errCh
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
+
+func (c *command) streamError(ctx context.Context, stopErr, waitErr, scanErr error) error {
+	if stopErr != nil {
+		c.logger(ctx).Infof("execute shell command stream stopped, command=%s, reason=%s", c.String(), stopErr)
+		return stopErr
+	}
+	// the process is killed once the output can not be read, so the error of reading it comes first
+	if scanErr != nil {
+		c.logger(ctx).Errorf("read shell command stream output error, command=%s, error=%s", c.String(), scanErr)
+		return errors.Wrapf(scanErr, "error when read output of shell command %s", mask.Mask(c.cmd))
+	}
+	if waitErr != nil {
+		if exitError, ok := waitErr.(*exec.ExitError); ok {
+			c.logger(ctx).Infof("execute shell command stream failed, command=%s, exitCode=%d", c.String(), exitError.ExitCode())
+			return ExecuteResult{Command: c.String(), ExitCode: exitError.ExitCode()}.AsError()
+		}
+		c.logger(ctx).Errorf("execute shell command stream error, command=%s, error=%s", c.String(), waitErr)
+		return errors.Errorf("error when execute shell command %s: %s", mask.Mask(c.cmd), waitErr)
+	}
+	c.logger(ctx).Infof("execute shell command stream end, command=%s", c.String())
+	return nil
+}
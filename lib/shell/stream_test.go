@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteStream(t *testing.T) {
+	lines, errCh := libShell.NewCommand("echo a; echo b; echo c").ExecuteStream(context.Background())
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, got)
+	assert.NoError(t, <-errCh)
+}
+
+func TestExecuteStreamOutputMasking(t *testing.T) {
+	collect := func(cmd Command) []string {
+		lines, errCh := cmd.ExecuteStream(context.Background())
+		var got []string
+		for line := range lines {
+			got = append(got, line)
+		}
+		assert.NoError(t, <-errCh)
+		return got
+	}
+	assert.Equal(t, []string{"password=xxx"}, collect(libShell.NewCommand("echo password=secret")))
+	assert.Equal(t, []string{"password=secret"}, collect(libShell.NewCommand("echo password=secret").WithOutputMasking(false)))
+
+	SetRunner(RunnerFunc(func(ctx context.Context, cmd Command) (*ExecuteResult, error) {
+		return &ExecuteResult{Command: cmd.Cmd(), Output: "password=secret\n"}, nil
+	}))
+	defer SetRunner(nil)
+	assert.Equal(t, []string{"password=xxx"}, collect(libShell.NewCommand("echo")))
+}
+
+func TestExecuteStreamFailure(t *testing.T) {
+	lines, errCh := libShell.NewCommand("echo a; exit 3").ExecuteStream(context.Background())
+	for range lines {
+	}
+	assert.Error(t, <-errCh)
+}
+
+func TestExecuteStreamCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	lines, errCh := libShell.NewCommand("while true; do echo a; done").ExecuteStream(ctx)
+	<-lines
+	// stop reading and cancel, the stream should be torn down
+	cancel()
+	select {
+	case err := <-errCh:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not stopped after cancel")
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before+1)
+}
+
+func TestExecuteStreamLineTooLong(t *testing.T) {
+	// the process keeps writing after the long line, it is killed instead of drained
+	cmd := "head -c 100 /dev/zero | tr '\\0' a; echo; while true; do echo b; sleep 0.01; done"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines, errCh := libShell.NewCommand(cmd).WithMaxLineBytes(64).WithNoTimeout().ExecuteStream(ctx)
+	for range lines {
+	}
+	select {
+	case err := <-errCh:
+		assert.True(t, errors.Is(err, bufio.ErrTooLong))
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not stopped after a line too long")
+	}
+
+	lines, errCh = libShell.NewCommand("head -c 100 /dev/zero | tr '\\0' a; echo").WithMaxLineBytes(128).ExecuteStream(context.Background())
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+	assert.NoError(t, <-errCh)
+	assert.Equal(t, []string{strings.Repeat("a", 100)}, got)
+}
+
+func TestExecuteStreamNoTimeoutNotCancellable(t *testing.T) {
+	lines, errCh := libShell.NewCommand("tail -f /dev/null").WithNoTimeout().ExecuteStream(context.Background())
+	for range lines {
+	}
+	assert.Error(t, <-errCh)
+}
+
+func TestExecuteForEachLine(t *testing.T) {
+	var got []string
+	err := libShell.NewCommand("echo a; echo b; echo c").ExecuteForEachLine(context.Background(), func(line string) error {
+		got = append(got, line)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, got)
+
+	stop := errors.New("stop")
+	start := time.Now()
+	got = nil
+	err = libShell.NewCommand("while true; do echo a; sleep 0.01; done").ExecuteForEachLine(context.Background(), func(line string) error {
+		got = append(got, line)
+		if len(got) == 3 {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(t, stop, err)
+	assert.Len(t, got, 3)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestExecuteStreamWithRunner(t *testing.T) {
+	SetRunner(RunnerFunc(func(ctx context.Context, cmd Command) (*ExecuteResult, error) {
+		return &ExecuteResult{Command: cmd.Cmd(), ExitCode: 3, Output: "a\nb\n"}, nil
+	}))
+	defer SetRunner(nil)
+	lines, errCh := libShell.NewCommand("tail -f x.log").ExecuteStream(context.Background())
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+	assert.Equal(t, []string{"a", "b"}, got)
+	assert.Error(t, <-errCh)
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// Template is a shell command with {{name}} placeholders, each of which is substituted by the value bound to it,
+// quoted as one literal word, so that values with spaces, quotes or shell metacharacters can not inject commands.
+// Placeholders should not be quoted in the template, e.g. use ls -l {{dir}} instead of ls -l '{{dir}}'.
+type Template struct {
+	tmpl   string
+	values map[string]string
+	shell  Shell
+}
+
+// NewTemplate creates a template of command, e.g. NewTemplate("du -sh {{dir}}").Bind("dir", dir).Command().
+func NewTemplate(tmpl string) *Template {
+	return &Template{
+		tmpl:   tmpl,
+		values: make(map[string]string),
+		shell:  ShellImpl{},
+	}
+}
+
+// Bind binds value to the placeholder name, replacing the value bound before.
+func (t *Template) Bind(name string, value string) *Template {
+	t.values[name] = value
+	return t
+}
+
+// Render returns the command with the placeholders substituted by the quoted values.
+// It fails if any placeholder is not bound.
+func (t *Template) Render() (string, error) {
+	var missing []string
+	cmd := placeholderPattern.ReplaceAllStringFunc(t.tmpl, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		value, ok := t.values[name]
+		if !ok {
+			missing = append(missing, name)
+			return placeholder
+		}
+		return QuoteArg(value)
+	})
+	if len(missing) > 0 {
+		return "", errors.Errorf("placeholders %s of template %s are not bound", strings.Join(missing, ", "), t.tmpl)
+	}
+	return cmd, nil
+}
+
+// Command renders the template into a command, see Render.
+func (t *Template) Command() (Command, error) {
+	cmd, err := t.Render()
+	if err != nil {
+		return nil, err
+	}
+	return t.shell.NewCommand(cmd), nil
+}
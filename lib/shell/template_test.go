@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate(t *testing.T) {
+	values := []string{"a b", "it's", `"quoted"`, "$HOME `id` $(id)", "a; rm -rf /tmp/obagent_not_exist", "", "{{b}}"}
+	for _, value := range values {
+		cmd, err := NewTemplate("printf '%s|' {{a}} {{ b }}").Bind("a", value).Bind("b", "end").Command()
+		require.NoError(t, err)
+		result, err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Equal(t, value+"|end|", result.Output)
+	}
+}
+
+func TestTemplateRender(t *testing.T) {
+	cmd, err := NewTemplate("du -sh {{dir}}").Bind("dir", "/data/log1").Render()
+	require.NoError(t, err)
+	assert.Equal(t, "du -sh '/data/log1'", cmd)
+
+	_, err = NewTemplate("cp {{src}} {{dst}}").Bind("src", "a").Render()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "placeholders dst of template cp {{src}} {{dst}} are not bound")
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"sync"
+	"time"
+)
+
+// outputRateLimit is the max rate of output to read, and how long the output may keep exceeding it.
+type outputRateLimit struct {
+	bytesPerSec int
+	killAfter   time.Duration // 0 means never killing the command for its output rate
+}
+
+// WithOutputRateLimit limits the rate of reading the output of the command to bytesPerSec, bursts of up to
+// bytesPerSec bytes are read at once. A command writing faster blocks on writing, so that a command spewing output
+// can not saturate the agent, while commands writing slower are not affected. bytesPerSec <= 0 means unlimited.
+func (c *command) WithOutputRateLimit(bytesPerSec int) Command {
+	c.outputRate.bytesPerSec = bytesPerSec
+	return c
+}
+
+// WithOutputRateLimitKill makes the command killed with ErrOutputRateExceeded if its output keeps exceeding the rate
+// limit of WithOutputRateLimit for after. It applies to Execute and its variants only.
+func (c *command) WithOutputRateLimitKill(after time.Duration) Command {
+	c.outputRate.killAfter = after
+	return c
+}
+
+// outputThrottle is a token bucket of bytes, delaying writes of the output exceeding the rate.
+// It sends ErrOutputRateExceeded to abort if the writes are delayed continuously for killAfter,
+// and stops delaying then, so that the output left in the pipe is read quickly once the command is killed.
+// It also stops delaying once the command is terminated for other reasons, e.g. the timeout, see stop.
+type outputThrottle struct {
+	mu         sync.Mutex
+	rate       float64 // bytes per second, also the size of the bucket
+	tokens     float64
+	last       time.Time
+	since      time.Time // time the writes start to be delayed continuously, zero if the last write is not delayed
+	throttled  time.Duration
+	killAfter  time.Duration
+	abort      chan<- error
+	terminated bool
+	done       chan struct{} // closed by stop to interrupt the delayed writes
+	stopOnce   sync.Once
+}
+
+func newOutputThrottle(bytesPerSec int, killAfter time.Duration, abort chan<- error) *outputThrottle {
+	return &outputThrottle{
+		rate:      float64(bytesPerSec),
+		tokens:    float64(bytesPerSec),
+		last:      time.Now(),
+		killAfter: killAfter,
+		abort:     abort,
+		done:      make(chan struct{}),
+	}
+}
+
+// chunkSize is the max bytes of a write to wait for at once, so that a single write is delayed for at most a second
+// before the next check of stop.
+func (t *outputThrottle) chunkSize() int {
+	if t.rate < 1 {
+		return 1
+	}
+	return int(t.rate)
+}
+
+// stop stops delaying the writes, including the ones being delayed, it is called when the command is terminated.
+func (t *outputThrottle) stop() {
+	t.stopOnce.Do(func() {
+		t.mu.Lock()
+		t.terminated = true
+		t.mu.Unlock()
+		close(t.done)
+	})
+}
+
+// wait blocks until n bytes are allowed to write, or the throttle is stopped.
+func (t *outputThrottle) wait(n int) {
+	t.mu.Lock()
+	if t.terminated {
+		t.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.rate {
+		t.tokens = t.rate
+	}
+	t.last = now
+	t.tokens -= float64(n)
+	if t.tokens >= 0 {
+		t.since = time.Time{}
+		t.mu.Unlock()
+		return
+	}
+	delay := time.Duration(-t.tokens / t.rate * float64(time.Second))
+	if t.since.IsZero() {
+		t.since = now
+	}
+	if t.killAfter > 0 && now.Add(delay).Sub(t.since) > t.killAfter {
+		t.mu.Unlock()
+		t.stop()
+		sendAbort(t.abort, ErrOutputRateExceeded)
+		return
+	}
+	t.throttled += delay
+	t.mu.Unlock()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-t.done:
+	}
+}
+
+func (t *outputThrottle) total() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.throttled
+}
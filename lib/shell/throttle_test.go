@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteWithOutputRateLimit(t *testing.T) {
+	result, err := libShell.NewCommand("echo a").WithOutputRateLimit(1000).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "a\n", result.Output)
+	assert.Equal(t, time.Duration(0), result.Throttled)
+
+	// the first 100000 bytes are a burst, the rest takes about a second
+	start := time.Now()
+	result, err = libShell.NewCommand("head -c 200000 /dev/zero").WithOutputRateLimit(100000).Execute()
+	require.NoError(t, err)
+	assert.Len(t, result.Bytes(), 200000)
+	assert.GreaterOrEqual(t, time.Since(start), 800*time.Millisecond)
+	assert.Greater(t, result.Throttled, 500*time.Millisecond)
+}
+
+func TestExecuteWithOutputRateLimitKill(t *testing.T) {
+	start := time.Now()
+	result, err := libShell.NewCommand("cat /dev/zero").WithOutputRateLimit(10000).WithOutputRateLimitKill(300 * time.Millisecond).
+		WithMaxOutputBytes(1000).Execute()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrOutputRateExceeded))
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.NotNil(t, result)
+	assert.True(t, result.Killed)
+
+	// output slower than the limit is not killed
+	result, err = libShell.NewCommand("for i in 1 2 3 4 5; do echo $i; sleep 0.1; done").WithOutputRateLimit(100).
+		WithOutputRateLimitKill(100 * time.Millisecond).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, result.Lines())
+}
+
+func TestExecuteWithOutputRateLimitTimeout(t *testing.T) {
+	// the delayed output does not keep the command from being killed on timeout
+	start := time.Now()
+	result, err := libShell.NewCommand("head -c 1000000 /dev/zero").WithOutputRateLimit(10000).
+		WithTimeout(time.Second).Execute()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+	assert.Less(t, time.Since(start), 3*time.Second)
+	require.NotNil(t, result)
+	assert.True(t, result.Killed)
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/oceanbase/obagent/lib/mask"
+)
+
+// maxTimedLines is the max number of timestamped lines to keep, the following lines are dropped.
+const maxTimedLines = 10000
+
+// OutputStream is the stream a line of output is written to.
+type OutputStream string
+
+const (
+	StdoutStream OutputStream = "stdout"
+	StderrStream OutputStream = "stderr"
+)
+
+// OutputLine is a line of output with the time it is produced, kept by WithTimestampedOutput.
+type OutputLine struct {
+	Offset time.Duration // time since the process is started when the line ends
+	Stream OutputStream
+	Text   string // without the line ending, transcoded, stripped and masked like Output
+}
+
+// WithTimestampedOutput records each line of the kept output with the time it is produced in TimedLines of the result,
+// e.g. to find out that a script printed nothing for a long time before a stall.
+// Lines of output written to the writer of WithOutputWriter are not recorded, and at most 10000 lines are recorded.
+func (c *command) WithTimestampedOutput() Command {
+	c.timestamped = true
+	return c
+}
+
+type timedLine struct {
+	at     time.Time
+	stream OutputStream
+	text   string
+}
+
+// outputTimeline splits the output of each stream into lines, and records the time each line ends.
+// It is not safe for concurrent use, the lock of outputCapture serializes the writes.
+type outputTimeline struct {
+	lines   []timedLine
+	partial map[OutputStream]*bytes.Buffer
+}
+
+func newOutputTimeline() *outputTimeline {
+	return &outputTimeline{
+		partial: map[OutputStream]*bytes.Buffer{
+			StdoutStream: {},
+			StderrStream: {},
+		},
+	}
+}
+
+func (t *outputTimeline) write(stream OutputStream, p []byte, at time.Time) {
+	partial := t.partial[stream]
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			partial.Write(p)
+			return
+		}
+		partial.Write(p[:i])
+		t.push(stream, partial.String(), at)
+		partial.Reset()
+		p = p[i+1:]
+	}
+}
+
+func (t *outputTimeline) push(stream OutputStream, text string, at time.Time) {
+	if len(t.lines) >= maxTimedLines {
+		return
+	}
+	t.lines = append(t.lines, timedLine{at: at, stream: stream, text: strings.TrimSuffix(text, "\r")})
+}
+
+// flush records the last lines without line endings, as if they end at the time.
+func (t *outputTimeline) flush(at time.Time) {
+	for _, stream := range []OutputStream{StdoutStream, StderrStream} {
+		if partial := t.partial[stream]; partial.Len() > 0 {
+			t.push(stream, partial.String(), at)
+			partial.Reset()
+		}
+	}
+}
+
+// timedLines returns the recorded lines of the capture with offsets from startedAt, or nil if they are not recorded.
+func (c *command) timedLines(ctx context.Context, capture *outputCapture, startedAt time.Time, endedAt time.Time) []OutputLine {
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	if capture.timeline == nil {
+		return nil
+	}
+	capture.timeline.flush(endedAt)
+	lines := make([]OutputLine, 0, len(capture.timeline.lines))
+	for _, line := range capture.timeline.lines {
+		text := c.decodeOutput(line.text)
+		if c.stripANSI {
+			text = StripANSI(text)
+		}
+		if !c.noOutputMasking {
+			text = mask.MaskFromContext(ctx, text)
+		}
+		offset := line.at.Sub(startedAt)
+		if offset < 0 {
+			offset = 0
+		}
+		lines = append(lines, OutputLine{Offset: offset, Stream: line.stream, Text: text})
+	}
+	return lines
+}
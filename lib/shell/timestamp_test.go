@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteWithTimestampedOutput(t *testing.T) {
+	result, err := libShell.NewCommand("echo a; sleep 0.3; echo password=secret >&2; printf c").WithTimestampedOutput().Execute()
+	require.NoError(t, err)
+	require.Len(t, result.TimedLines, 3)
+	assert.Equal(t, OutputLine{Offset: result.TimedLines[0].Offset, Stream: StdoutStream, Text: "a"}, result.TimedLines[0])
+	assert.Equal(t, StderrStream, result.TimedLines[1].Stream)
+	assert.Equal(t, "password=xxx", result.TimedLines[1].Text)
+	// the last line without line ending is kept too
+	assert.Equal(t, "c", result.TimedLines[2].Text)
+	// the copy of the output may be delayed a little
+	assert.True(t, result.TimedLines[1].Offset-result.TimedLines[0].Offset >= 250*time.Millisecond)
+	assert.True(t, result.TimedLines[2].Offset <= result.Duration)
+
+	result, err = libShell.NewCommand("echo a").Execute()
+	require.NoError(t, err)
+	assert.Nil(t, result.TimedLines)
+}
+
+func TestOutputTimeline(t *testing.T) {
+	timeline := newOutputTimeline()
+	at := time.Now()
+	timeline.write(StdoutStream, []byte("a\r\nb"), at)
+	timeline.write(StderrStream, []byte("x\n"), at.Add(time.Second))
+	timeline.write(StdoutStream, []byte("c\n"), at.Add(2*time.Second))
+	timeline.flush(at.Add(3 * time.Second))
+	assert.Equal(t, []timedLine{
+		{at: at, stream: StdoutStream, text: "a"},
+		{at: at.Add(time.Second), stream: StderrStream, text: "x"},
+		{at: at.Add(2 * time.Second), stream: StdoutStream, text: "bc"},
+	}, timeline.lines)
+}
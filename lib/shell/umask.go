@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// WithUmask sets the umask of the command, e.g. 0027, so that the files it creates get the same permissions
+// regardless of the umask of the agent. There is no way to set the umask of a child process by exec,
+// so the command is wrapped by sh to set it first: the umask command is prepended to a shell command,
+// and a command with args is run by sh -c 'umask 0027 && exec "$@"'. The resolved command shows the wrapper.
+// It is only supported with sh compatible shells on unix, not with cmd or PowerShell.
+func (c *command) WithUmask(mask int) Command {
+	c.umask = &mask
+	return c
+}
+
+// validateUmask checks that the umask is valid and can be applied to the command.
+func (c *command) validateUmask() error {
+	if c.umask == nil {
+		return nil
+	}
+	if *c.umask < 0 || *c.umask > 0777 {
+		return errors.Errorf("invalid umask %#o: should be between 0 and 0777", *c.umask)
+	}
+	if runtime.GOOS == "windows" {
+		return errors.New("can not run command with umask: not supported on windows")
+	}
+	switch c.program.name() {
+	case string(Cmd), string(PowerShell), string(Pwsh):
+		if c.argv == nil {
+			return errors.Errorf("can not run command with umask: not supported by %s", c.program)
+		}
+	}
+	return nil
+}
+
+// withUmaskApplied returns a copy of the command wrapped to set the umask before running, or the command itself
+// if the umask is not set.
+func (c *command) withUmaskApplied() *command {
+	if c.umask == nil {
+		return c
+	}
+	umask := fmt.Sprintf("umask %04o", *c.umask)
+	wrapped := *c
+	wrapped.umask = nil
+	if c.argv != nil {
+		wrapped.argv = append([]string{fallbackShell, "-c", umask + ` && exec "$@"`, "sh"}, c.argv...)
+	} else {
+		wrapped.cmd = umask + "; " + c.cmd
+	}
+	return &wrapped
+}
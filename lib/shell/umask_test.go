@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+//go:build !windows
+// +build !windows
+
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteWithUmask(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a")
+	_, err := libShell.NewCommand("touch " + QuoteArg(file)).WithUmask(0077).Execute()
+	require.NoError(t, err)
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	file = filepath.Join(dir, "b")
+	cmd := libShell.NewArgsCommand("mkdir", file).WithUmask(0027)
+	_, err = cmd.Execute()
+	require.NoError(t, err)
+	info, err = os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+
+	result, err := cmd.WithDryRun().Execute()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/bin/sh", "-c", `umask 0027 && exec "$@"`, "sh", "mkdir", file}, result.Argv)
+
+	_, err = libShell.NewCommand("true").WithUmask(01000).Execute()
+	assert.Error(t, err)
+	_, err = libShell.NewCommand("true").WithProgram(PowerShell).WithUmask(0022).Execute()
+	assert.Error(t, err)
+}
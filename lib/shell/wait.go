@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// terminatePolicy decides how to terminate the process group of a command on timeout or cancellation.
+type terminatePolicy struct {
+	grace  time.Duration                        // time to wait after SIGTERM before SIGKILL, 0 means SIGKILL immediately
+	signal syscall.Signal                       // signal to send instead of SIGTERM during the grace, 0 means SIGTERM
+	logger func(ctx context.Context) *log.Entry // logger to use, if not provided, use the global logger
+	// called before terminating the process if not nil, e.g. to stop the output throttle blocking Wait
+	onTerminate func()
+}
+
+// KillGrace is the amount of time we allow a process to shutdown before
+// sending a SIGKILL.
+const KillGrace = 5 * time.Second
+
+// WaitTimeout waits for the given command to finish with a timeout.
+// It assumes the command has already been started.
+// If the command times out, it sends SIGTERM to the process group, and SIGKILL if it is still alive after KillGrace.
+// A process that exits without error after SIGTERM is treated as success.
+func WaitTimeout(c *exec.Cmd, timeout time.Duration) error {
+	waitErr, reason := waitProcess(context.Background(), c, timeout, nil, terminatePolicy{grace: KillGrace})
+	// If the process exited without error treat it as success.  This allows a
+	// process to do a clean shutdown on signal.
+	if waitErr == nil {
+		return nil
+	}
+	if reason != nil {
+		return ErrCommandTimeout
+	}
+	return waitErr
+}
+
+// waitCommand waits for the started command to exit. When the timeout elapses, a reason is received from abort,
+// e.g. ErrIdleTimeout, or ctx is done, the process group is terminated according to the policy,
+// and ErrCommandTimeout, the reason or ctx.Err() is returned.
+// A timeout <= 0 means waiting without timeout, and a nil abort means never aborting.
+func waitCommand(ctx context.Context, c *exec.Cmd, timeout time.Duration, abort <-chan error, policy terminatePolicy) error {
+	waitErr, reason := waitProcess(ctx, c, timeout, abort, policy)
+	if reason != nil {
+		return reason
+	}
+	return waitErr
+}
+
+// waitProcess waits for the started command to exit, terminating it on timeout or cancellation.
+// It returns the error of c.Wait and the reason of termination, which is nil if the process exited by itself.
+// It only returns after c.Wait returns, so the wait goroutine never outlives it,
+// and no signal is sent after that, when the pid may have been reused.
+func waitProcess(ctx context.Context, c *exec.Cmd, timeout time.Duration, abort <-chan error, policy terminatePolicy) (waitErr error, reason error) {
+	exited := make(chan struct{})
+	go func() {
+		waitErr = c.Wait()
+		close(exited)
+	}()
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer stopTimer(timer)
+		timeoutCh = timer.C
+	}
+	select {
+	case <-exited:
+		return waitErr, nil
+	case <-timeoutCh:
+		reason = ErrCommandTimeout
+	case reason = <-abort:
+	case <-ctx.Done():
+		reason = ctx.Err()
+	}
+	terminatedAt := time.Now()
+	if policy.onTerminate != nil {
+		policy.onTerminate()
+	}
+	policy.terminate(ctx, c, exited)
+	<-exited
+	// a process taking long to exit after SIGKILL is likely stuck in the kernel, e.g. on a hung disk
+	policy.log(ctx).Infof("[agent] process %d exited %s after termination: %s", c.Process.Pid, time.Since(terminatedAt), reason)
+	return waitErr, reason
+}
+
+// stopTimer stops the timer and drains its channel if it has fired.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
+
+// terminate terminates the process group. exited should be closed once the process exits,
+// which ends the grace period early. SIGKILL is always sent after the grace period,
+// even if SIGTERM fails, so that a process ignoring or missing SIGTERM can not block the waiter forever.
+func (p terminatePolicy) terminate(ctx context.Context, c *exec.Cmd, exited <-chan struct{}) {
+	sig := syscall.SIGTERM
+	if p.signal != 0 {
+		sig = p.signal
+	}
+	if p.grace > 0 && sig != syscall.SIGKILL {
+		if err := signalProcessGroup(c.Process, sig); err != nil {
+			p.log(ctx).Errorf("[agent] Error terminating process: %s", err)
+		}
+		timer := time.NewTimer(p.grace)
+		defer stopTimer(timer)
+		select {
+		case <-exited:
+			return
+		case <-timer.C:
+		}
+	}
+	if err := signalProcessGroup(c.Process, syscall.SIGKILL); err != nil {
+		// the process can not be killed, e.g. without permission, waiting for it may hang
+		p.log(ctx).Errorf("[agent] Error killing process %d, it may be left running: %s", c.Process.Pid, err)
+	}
+}
+
+func (p terminatePolicy) log(ctx context.Context) *log.Entry {
+	if p.logger != nil {
+		return p.logger(ctx)
+	}
+	return log.WithContext(ctx)
+}
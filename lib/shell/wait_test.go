@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package shell
+
+import (
+	"os/exec"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitTimeout(t *testing.T) {
+	c := exec.Command("sh", "-c", "exit 2")
+	assert.NoError(t, startCmd(c))
+	_, ok := WaitTimeout(c, time.Second).(*exec.ExitError)
+	assert.True(t, ok)
+
+	c = exec.Command("sleep", "10")
+	assert.NoError(t, startCmd(c))
+	assert.Equal(t, ErrCommandTimeout, WaitTimeout(c, 10*time.Millisecond))
+}
+
+func TestWaitTimeoutNoGoroutineLeak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test due to long running.")
+	}
+	before := runtime.NumGoroutine()
+	const total, parallel = 1000, 100
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallel)
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if i%2 == 0 {
+				_, err := libShell.NewCommand("sleep 10").WithTimeout(5 * time.Millisecond).Execute()
+				assert.ErrorIs(t, err, ErrCommandTimeout)
+				return
+			}
+			c := exec.Command("sleep", "10")
+			if assert.NoError(t, startCmd(c)) {
+				assert.Equal(t, ErrCommandTimeout, WaitTimeout(c, 5*time.Millisecond))
+			}
+		}(i)
+	}
+	wg.Wait()
+	time.Sleep(100 * time.Millisecond)
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before+2)
+}
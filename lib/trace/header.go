@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/google/uuid"
+
 	agentlog "github.com/oceanbase/obagent/log"
 )
 
@@ -32,7 +34,7 @@ func GetTraceId(request *http.Request) string {
 	// If no traceId passed, generate one.
 	traceId := request.Header.Get(TraceIdHeader)
 	if traceId == "" {
-		traceId = RandomTraceId()
+		traceId = uuid.New().String()
 	}
 	return traceId
 }
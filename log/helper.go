@@ -13,6 +13,7 @@
 package log
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/sirupsen/logrus"
@@ -29,3 +30,24 @@ func Fields(kv ...interface{}) *logrus.Entry {
 	}
 	return logrus.WithFields(fields)
 }
+
+type contextFieldsKey struct{}
+
+// WithContextFields returns a context carrying fields in addition to the ones of ctx.
+// The fields are structured fields of the logs with the context in JSON format,
+// text logs leave them out, as they are usually in the messages already.
+func WithContextFields(ctx context.Context, fields logrus.Fields) context.Context {
+	merged := make(logrus.Fields, len(fields))
+	for k, v := range contextFields(ctx) {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, contextFieldsKey{}, merged)
+}
+
+func contextFields(ctx context.Context) logrus.Fields {
+	fields, _ := ctx.Value(contextFieldsKey{}).(logrus.Fields)
+	return fields
+}
@@ -13,12 +13,17 @@
 package log
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/oceanbase/obagent/lib/mask"
 )
 
 type CallerHook struct{}
@@ -74,3 +79,108 @@ func (hook *CostDurationHook) Fire(entry *logrus.Entry) error {
 func (hook *CostDurationHook) Levels() []logrus.Level {
 	return logrus.AllLevels
 }
+
+// ContextHook sets the trace id, actor and start time in the context of entries as their fields,
+// so that the logs of shell commands and API handlers carry them without each call site doing it.
+type ContextHook struct{}
+
+func (hook *ContextHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	setContextFields(entry.Data, entry.Context)
+	return nil
+}
+
+func (hook *ContextHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func setContextFields(data logrus.Fields, ctx context.Context) {
+	if traceId, ok := ctx.Value(TraceIdKey{}).(string); ok && traceId != "" {
+		data[FieldKeyTraceId] = traceId
+	}
+	if actor, ok := ctx.Value(ActorKey{}).(string); ok && actor != "" {
+		data[FieldKeyActor] = actor
+	}
+	if operator, ok := ctx.Value(ClaimedOperatorKey{}).(string); ok && operator != "" {
+		data[FieldKeyClaimedOperator] = operator
+	}
+	if startTime, ok := ctx.Value(StartTimeKey).(time.Time); ok {
+		data[FieldKeyStartTime] = startTime
+	}
+}
+
+var maskingDisabled int32
+
+// SetMasking sets whether MaskHook masks the logs, it is enabled by default.
+func SetMasking(enabled bool) {
+	var disabled int32
+	if !enabled {
+		disabled = 1
+	}
+	atomic.StoreInt32(&maskingDisabled, disabled)
+}
+
+// MaskHook masks secrets in the messages and fields of entries by mask.Mask, in case a call site logs them
+// without masking. Fields of strings, errors and fmt.Stringer are masked as the strings they are formatted as,
+// including the fields of the context, see WithContextFields. Entries with a context of a trusted debug session
+// are kept as is, see mask.WithUnmasked, and so are entries dropped by the formatters for their level field.
+type MaskHook struct{}
+
+func (hook *MaskHook) Fire(entry *logrus.Entry) error {
+	if atomic.LoadInt32(&maskingDisabled) != 0 || mask.IsUnmasked(entry.Context) || !wrappedLevelEnabled(entry) {
+		return nil
+	}
+	entry.Message = mask.Mask(entry.Message)
+	for k, v := range entry.Data {
+		if masked, ok := maskValue(v); ok {
+			entry.Data[k] = masked
+		}
+	}
+	if entry.Context != nil {
+		// the fields of the context are shared by other entries, so they are replaced by masked copies
+		if fields := contextFields(entry.Context); len(fields) > 0 {
+			masked := make(logrus.Fields, len(fields))
+			for k, v := range fields {
+				masked[k] = v
+				if m, ok := maskValue(v); ok {
+					masked[k] = m
+				}
+			}
+			entry.Context = context.WithValue(entry.Context, contextFieldsKey{}, masked)
+		}
+	}
+	return nil
+}
+
+// maskValue returns the masked string of v if it is formatted as a string that may carry secrets.
+// Times and durations are formatted by the formatters specially and carry no secrets.
+func maskValue(v interface{}) (string, bool) {
+	switch value := v.(type) {
+	case string:
+		return mask.Mask(value), true
+	case time.Time, time.Duration:
+		return "", false
+	case error:
+		return mask.Mask(value.Error()), true
+	case fmt.Stringer:
+		return mask.Mask(value.String()), true
+	}
+	return "", false
+}
+
+// wrappedLevelEnabled reports whether the level field of an entry of a wrapped logger, e.g. go-kit of node_exporter,
+// is enabled, the formatters drop the entry otherwise.
+func wrappedLevelEnabled(entry *logrus.Entry) bool {
+	levelRaw, ok := entry.Data[logrus.FieldKeyLevel]
+	if !ok || entry.Logger == nil {
+		return true
+	}
+	level, err := logrus.ParseLevel(fmt.Sprint(levelRaw))
+	return err != nil || entry.Logger.IsLevelEnabled(level)
+}
+
+func (hook *MaskHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
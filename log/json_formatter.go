@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	FieldKeyPid             = "pid"
+	FieldKeyTraceId         = "traceId"
+	FieldKeyStartTime       = "startTime"
+	FieldKeyActor           = "actor"
+	FieldKeyClaimedOperator = "claimedOperator"
+)
+
+// JSONFormatter formats logs into single line JSON objects for log aggregation, e.g. ELK.
+// Besides the fields of the entry, e.g. the trace id and start time set by ContextHook, the fields of its context
+// are structured fields, see WithContextFields. Durations are rendered in milliseconds.
+type JSONFormatter struct {
+	// TimestampFormat to use for the time field
+	TimestampFormat string
+
+	// FieldMap allows users to customize the names of level texts like TextFormatter
+	FieldMap FieldMap
+}
+
+func (f *JSONFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(entry.Data)+6)
+	if entry.Context != nil {
+		for k, v := range contextFields(entry.Context) {
+			data[k] = v
+		}
+	}
+	for k, v := range entry.Data {
+		data[k] = v
+	}
+	// fix log warp, such as node_exporter go-kit
+	if levelRaw, ex := data[logrus.FieldKeyLevel]; ex {
+		levelStr := fmt.Sprint(levelRaw)
+		level, err := logrus.ParseLevel(levelStr)
+		if err != nil {
+			return nil, fmt.Errorf("parse %+v to logrus.Level failed, err:+%v", level, err)
+		}
+		if !entry.Logger.IsLevelEnabled(level) {
+			return nil, nil
+		}
+	}
+	prefixFieldClashes(data, nil, entry.HasCaller())
+	if v, ok := data[FieldKeyPid]; ok {
+		data["fields."+FieldKeyPid] = v
+		delete(data, FieldKeyPid)
+	}
+	if entry.Context != nil {
+		// the logger may be without ContextHook
+		if _, ok := data[FieldKeyTraceId]; !ok {
+			setContextFields(data, entry.Context)
+		}
+	}
+
+	timestampFormat := f.TimestampFormat
+	if timestampFormat == "" {
+		timestampFormat = defaultTimestampFormat
+	}
+	for k, v := range data {
+		switch value := v.(type) {
+		case time.Duration:
+			data[k] = float64(value) / float64(time.Millisecond)
+		case time.Time:
+			data[k] = value.Format(timestampFormat)
+		case error:
+			// errors are not marshalled by encoding/json
+			data[k] = value.Error()
+		}
+	}
+	data[logrus.FieldKeyTime] = entry.Time.Format(timestampFormat)
+	data[logrus.FieldKeyLevel] = f.FieldMap.resolve(strings.ToUpper(entry.Level.String()))
+	data[logrus.FieldKeyMsg] = strings.TrimSuffix(entry.Message, "\n")
+	data[FieldKeyPid] = pid
+
+	var b *bytes.Buffer
+	if entry.Buffer != nil {
+		b = entry.Buffer
+	} else {
+		b = &bytes.Buffer{}
+	}
+	encoder := json.NewEncoder(b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(data); err != nil {
+		return nil, fmt.Errorf("failed to marshal fields to JSON, %v", err)
+	}
+	return b.Bytes(), nil
+}
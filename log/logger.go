@@ -19,6 +19,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/natefinch/lumberjack.v2"
@@ -30,6 +31,18 @@ const (
 
 const defaultTimestampFormat = "2006-01-02T15:04:05.99999-07:00"
 
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var jsonFormatter = &JSONFormatter{
+	TimestampFormat: defaultTimestampFormat,
+	FieldMap: map[string]string{
+		"WARNING": "WARN",
+	},
+}
+
 var textFormatter = &TextFormatter{
 	TimestampFormat:        defaultTimestampFormat, // log timestamp format
 	FullTimestamp:          true,
@@ -78,6 +91,15 @@ type LoggerConfig struct {
 	MaxBackups int    `yaml:"maxbackups"`
 	LocalTime  bool   `yaml:"localtime"`
 	Compress   bool   `yaml:"compress"`
+	// Format is text, the default, or json
+	Format string `yaml:"format"`
+	// SampleBurst is the number of identical messages logged per SampleInterval, 0 means unlimited
+	SampleBurst    int           `yaml:"sampleburst"`
+	SampleInterval time.Duration `yaml:"sampleinterval"`
+	// DisableMasking disables masking secrets in all logs, see MaskHook
+	DisableMasking bool `yaml:"disablemasking"`
+	// RotateInterval rotates the log file periodically besides by MaxSize, 0 means never
+	RotateInterval time.Duration `yaml:"rotateinterval"`
 }
 
 func InitLogger(config LoggerConfig) *logrus.Logger {
@@ -90,6 +112,7 @@ func InitLogger(config LoggerConfig) *logrus.Logger {
 			l.MaxAge = config.MaxAge
 			l.Compress = config.Compress
 			_ = l.Close()
+			startRotation(l, config.RotateInterval)
 		}
 	} else {
 		writer := &lumberjack.Logger{
@@ -101,8 +124,7 @@ func InitLogger(config LoggerConfig) *logrus.Logger {
 			LocalTime:  true,
 		}
 		logger.SetOutput(&noErrWriter{w: writer})
-		// log format
-		logger.SetFormatter(textFormatter)
+		startRotation(writer, config.RotateInterval)
 
 		// use CallerHook, not ReportCaller
 		logger.SetReportCaller(false)
@@ -110,9 +132,26 @@ func InitLogger(config LoggerConfig) *logrus.Logger {
 		// log hook
 		// cost duration hook
 		logger.AddHook(new(CostDurationHook))
+		// trace id and start time hook
+		logger.AddHook(new(ContextHook))
+		// mask hook
+		logger.AddHook(new(MaskHook))
 		// caller hook
 		logger.AddHook(new(CallerHook))
 	}
+	// log format
+	logFormatter, ok := formatter(config.Format)
+	stopSampling()
+	if config.SampleBurst > 0 && config.SampleInterval > 0 {
+		samplingFormatter := NewSamplingFormatter(logFormatter, config.SampleBurst, config.SampleInterval)
+		startSampling(samplingFormatter, logger.Out)
+		logFormatter = samplingFormatter
+	}
+	logger.SetFormatter(logFormatter)
+	if !ok {
+		logger.Warnf("unknown log format: %s, use %s instead", config.Format, FormatText)
+	}
+	SetMasking(!config.DisableMasking)
 	// log level
 	level, err := logrus.ParseLevel(config.Level)
 	if err != nil {
@@ -121,3 +160,71 @@ func InitLogger(config LoggerConfig) *logrus.Logger {
 	logger.SetLevel(level)
 	return logger
 }
+
+// formatter returns the formatter of format, or the text formatter with ok false if format is unknown.
+func formatter(format string) (f logrus.Formatter, ok bool) {
+	switch format {
+	case "", FormatText:
+		return textFormatter, true
+	case FormatJSON:
+		return jsonFormatter, true
+	default:
+		return textFormatter, false
+	}
+}
+
+var sampling struct {
+	mu   sync.Mutex
+	stop func()
+}
+
+// startSampling flushes the summaries of the messages suppressed by f to out, see SamplingFormatter.StartFlushing.
+func startSampling(f *SamplingFormatter, out io.Writer) {
+	sampling.mu.Lock()
+	defer sampling.mu.Unlock()
+	sampling.stop = f.StartFlushing(out)
+}
+
+// stopSampling stops flushing the summaries of the sampling formatter of the previous config.
+func stopSampling() {
+	sampling.mu.Lock()
+	defer sampling.mu.Unlock()
+	if sampling.stop != nil {
+		sampling.stop()
+		sampling.stop = nil
+	}
+}
+
+var rotation struct {
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// startRotation rotates the log file every interval, replacing the rotation of the previous config.
+func startRotation(writer *lumberjack.Logger, interval time.Duration) {
+	rotation.mu.Lock()
+	defer rotation.mu.Unlock()
+	if rotation.stop != nil {
+		close(rotation.stop)
+		rotation.stop = nil
+	}
+	if interval <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	rotation.stop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := writer.Rotate(); err != nil {
+					_, _ = fmt.Fprintf(os.Stderr, "rotate log failed %v\n", err)
+				}
+			}
+		}
+	}()
+}
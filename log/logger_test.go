@@ -15,18 +15,24 @@ package log
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/oceanbase/obagent/lib/mask"
 )
 
-func initlog() *logrus.Logger {
+func initlog(t *testing.T) *logrus.Logger {
 	return InitLogger(LoggerConfig{
 		Level:      "debug",
-		Filename:   "../tests/test.log",
+		Filename:   filepath.Join(t.TempDir(), "test.log"),
 		MaxSize:    10, // 10M
 		MaxAge:     3,  // 3days
 		MaxBackups: 3,
@@ -38,7 +44,7 @@ func initlog() *logrus.Logger {
 func TestLogExample(t *testing.T) {
 	buf := bytes.NewBuffer(make([]byte, 0, 1024))
 	_ = buf
-	logger := initlog()
+	logger := initlog(t)
 
 	// use logger
 	logger.Debugf("debug-log-%d", 1)
@@ -63,7 +69,7 @@ func TestLogExample(t *testing.T) {
 }
 
 func TestLogFile(t *testing.T) {
-	initlog()
+	initlog(t)
 
 	// use logrus
 	logrus.Debugf("debug-log-%d", 1)
@@ -71,7 +77,7 @@ func TestLogFile(t *testing.T) {
 }
 
 func TestLogDuration(t *testing.T) {
-	initlog()
+	initlog(t)
 
 	ctx := context.WithValue(context.Background(), StartTimeKey, time.Now())
 	log := logrus.WithContext(ctx)
@@ -80,7 +86,7 @@ func TestLogDuration(t *testing.T) {
 }
 
 func TestFields(t *testing.T) {
-	initlog()
+	initlog(t)
 
 	Fields("key1", 100, 2, 200.001, 3, "300").Infof("test fields")
 	Fields().Infof("test 0 fields")
@@ -117,3 +123,207 @@ func TestNoErrWriter(t *testing.T) {
 		t.Error("length wrong")
 	}
 }
+
+func TestJSONFormatter(t *testing.T) {
+	logger := logrus.New()
+	buf := bytes.NewBuffer(nil)
+	logger.SetOutput(buf)
+	f, _ := formatter(FormatJSON)
+	logger.SetFormatter(f)
+	logger.AddHook(new(CostDurationHook))
+
+	startTime := time.Now().Add(-time.Second)
+	ctx := context.WithValue(context.Background(), TraceIdKey{}, "TRACE-ID")
+	ctx = context.WithValue(ctx, StartTimeKey, startTime)
+	ctx = WithContextFields(ctx, logrus.Fields{"command": "echo ok"})
+	logger.WithContext(ctx).WithField("msg", "clash").WithError(fmt.Errorf("failed")).Warnf("execute %s", "end")
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &data); err != nil {
+		t.Fatalf("invalid JSON log %s: %v", buf.String(), err)
+	}
+	if data["level"] != "WARN" || data["msg"] != "execute end" || data["fields.msg"] != "clash" {
+		t.Errorf("wrong level or message: %s", buf.String())
+	}
+	if data["traceId"] != "TRACE-ID" || data["command"] != "echo ok" || data["error"] != "failed" {
+		t.Errorf("wrong fields: %s", buf.String())
+	}
+	if data["startTime"] != startTime.Format(defaultTimestampFormat) {
+		t.Errorf("wrong start time: %s", buf.String())
+	}
+	if duration, ok := data["duration"].(float64); !ok || duration < 1000 {
+		t.Errorf("wrong duration: %s", buf.String())
+	}
+}
+
+func TestUnknownFormatter(t *testing.T) {
+	f, ok := formatter("xml")
+	if ok || f != textFormatter {
+		t.Errorf("unknown format should fall back to text, got %T %v", f, ok)
+	}
+}
+
+func TestContextHook(t *testing.T) {
+	logger := logrus.New()
+	buf := bytes.NewBuffer(nil)
+	logger.SetOutput(buf)
+	logger.SetFormatter(textFormatter)
+	hook := new(ContextHook)
+	logger.AddHook(hook)
+	var fields logrus.Fields
+	logger.AddHook(&fieldsRecorder{fields: &fields})
+
+	startTime := time.Now()
+	ctx := context.WithValue(context.Background(), TraceIdKey{}, "TRACE-ID")
+	ctx = context.WithValue(ctx, StartTimeKey, startTime)
+	ctx = context.WithValue(ctx, ActorKey{}, "admin")
+	logger.WithContext(ctx).Info("with context")
+	if fields[FieldKeyTraceId] != "TRACE-ID" || fields[FieldKeyStartTime] != startTime || fields[FieldKeyActor] != "admin" {
+		t.Errorf("wrong context fields: %v", fields)
+	}
+	// the trace id is printed once, in its place
+	if !strings.Contains(buf.String(), ",TRACE-ID]") || !strings.HasSuffix(buf.String(), "fields: actor=admin\n") {
+		t.Errorf("wrong text log: %s", buf.String())
+	}
+
+	logger.Info("without context")
+	if _, ok := fields[FieldKeyTraceId]; ok {
+		t.Errorf("unexpected trace id: %v", fields)
+	}
+}
+
+type fieldsRecorder struct {
+	fields *logrus.Fields
+}
+
+func (r *fieldsRecorder) Fire(entry *logrus.Entry) error {
+	*r.fields = entry.Data
+	return nil
+}
+
+func (r *fieldsRecorder) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func TestSamplingFormatter(t *testing.T) {
+	logger := logrus.New()
+	buf := bytes.NewBuffer(nil)
+	logger.SetOutput(buf)
+	logger.SetFormatter(NewSamplingFormatter(textFormatter, 2, 50*time.Millisecond))
+
+	for i := 0; i < 10; i++ {
+		logger.Info("execute shell command start")
+		logger.Error("execute shell command error")
+	}
+	if n := strings.Count(buf.String(), "execute shell command start"); n != 2 {
+		t.Errorf("expect 2 sampled messages, got %d: %s", n, buf.String())
+	}
+	if n := strings.Count(buf.String(), "execute shell command error"); n != 10 {
+		t.Errorf("errors should not be sampled, got %d", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	buf.Reset()
+	logger.Info("execute shell command start")
+	if !strings.Contains(buf.String(), "8 identical messages suppressed") || strings.Count(buf.String(), "\n") != 2 {
+		t.Errorf("expect summary of suppressed messages: %s", buf.String())
+	}
+}
+
+func TestSamplingFormatterFlush(t *testing.T) {
+	logger := logrus.New()
+	buf := bytes.NewBuffer(nil)
+	logger.SetOutput(buf)
+	f := NewSamplingFormatter(textFormatter, 1, 50*time.Millisecond)
+	logger.SetFormatter(f)
+
+	for i := 0; i < 5; i++ {
+		logger.Info("execute shell command start")
+	}
+	out := bytes.NewBuffer(nil)
+	if err := f.Flush(out, time.Now()); err != nil || out.Len() != 0 {
+		t.Errorf("summary flushed before the interval ends: %s, %v", out.String(), err)
+	}
+
+	// the burst stops, the summary is flushed once the interval ends
+	stop := f.StartFlushing(out)
+	defer stop()
+	time.Sleep(120 * time.Millisecond)
+	stop()
+	if !strings.Contains(out.String(), "4 identical messages suppressed") || strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("expect summary of suppressed messages: %s", out.String())
+	}
+}
+
+func TestMaskHook(t *testing.T) {
+	logger := logrus.New()
+	buf := bytes.NewBuffer(nil)
+	logger.SetOutput(buf)
+	logger.SetFormatter(textFormatter)
+	logger.AddHook(new(MaskHook))
+
+	logger.WithField("dsn", "root:secret@tcp(127.0.0.1:2881)/oceanbase").Info("login with password=secret")
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("secret not masked: %s", buf.String())
+	}
+
+	buf.Reset()
+	logger.WithContext(mask.WithUnmasked(context.Background())).Info("login with password=secret")
+	if !strings.Contains(buf.String(), "password=secret") {
+		t.Errorf("unmasked context should be kept: %s", buf.String())
+	}
+
+	buf.Reset()
+	logger.WithError(fmt.Errorf("login with password=secret failed")).
+		WithField("cmd", secretStringer("mysql --password=secret")).Info("login failed")
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("error or stringer not masked: %s", buf.String())
+	}
+
+	buf.Reset()
+	logger.SetFormatter(jsonFormatter)
+	ctx := WithContextFields(context.Background(), logrus.Fields{"cmd": "mysql --password=secret"})
+	logger.WithContext(ctx).Info("execute command")
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("context field not masked: %s", buf.String())
+	}
+	if contextFields(ctx)["cmd"] != "mysql --password=secret" {
+		t.Errorf("context fields should not be changed: %v", contextFields(ctx))
+	}
+
+	// the entry of a wrapped logger below the level is dropped by the formatter, it is not masked
+	entry := logrus.NewEntry(logger).WithField(logrus.FieldKeyLevel, "debug")
+	entry.Message = "login with password=secret"
+	_ = new(MaskHook).Fire(entry)
+	if entry.Message != "login with password=secret" {
+		t.Errorf("dropped entry should not be masked: %s", entry.Message)
+	}
+
+	SetMasking(false)
+	defer SetMasking(true)
+	buf.Reset()
+	logger.Info("login with password=secret")
+	if !strings.Contains(buf.String(), "password=secret") {
+		t.Errorf("masking disabled: %s", buf.String())
+	}
+}
+
+type secretStringer string
+
+func (s secretStringer) String() string {
+	return string(s)
+}
+
+func TestStartRotation(t *testing.T) {
+	writer := &lumberjack.Logger{Filename: filepath.Join(t.TempDir(), "test.log")}
+	defer writer.Close()
+	startRotation(writer, 20*time.Millisecond)
+	defer startRotation(writer, 0)
+
+	_, _ = writer.Write([]byte("before rotation\n"))
+	time.Sleep(50 * time.Millisecond)
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(writer.Filename), "test-*.log"))
+	if len(files) == 0 {
+		t.Errorf("log not rotated")
+	}
+}
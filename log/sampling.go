@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxSampledMessages limits the memory of SamplingFormatter, the counters are reset when it is exceeded.
+const maxSampledMessages = 10000
+
+// SamplingFormatter drops identical messages beyond Burst per Interval, e.g. the start and end logs of
+// shell commands executed in a tight loop. The number of the dropped ones is logged as a summary before
+// the first message of the next interval, or by Flush once the interval ends, see StartFlushing.
+// Messages of warn or higher levels are never dropped.
+type SamplingFormatter struct {
+	Formatter logrus.Formatter
+	Burst     int
+	Interval  time.Duration
+
+	mu       sync.Mutex
+	counters map[string]*sampleCounter
+}
+
+type sampleCounter struct {
+	windowStart time.Time
+	count       int
+	suppressed  int
+	entry       logrus.Entry // the first message of the interval, the summary is logged like it
+}
+
+func NewSamplingFormatter(formatter logrus.Formatter, burst int, interval time.Duration) *SamplingFormatter {
+	return &SamplingFormatter{
+		Formatter: formatter,
+		Burst:     burst,
+		Interval:  interval,
+		counters:  make(map[string]*sampleCounter),
+	}
+}
+
+func (f *SamplingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if f.Burst <= 0 || entry.Level <= logrus.WarnLevel {
+		return f.Formatter.Format(entry)
+	}
+	suppressed, ok := f.sample(entry.Level.String()+":"+entry.Message, entry)
+	if !ok {
+		return nil, nil
+	}
+	if suppressed == 0 {
+		return f.Formatter.Format(entry)
+	}
+	summaryBytes, err := f.formatSummary(*entry, suppressed, entry.Time)
+	if err != nil {
+		return nil, err
+	}
+	entryBytes, err := f.Formatter.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte(nil), summaryBytes...), entryBytes...), nil
+}
+
+// sample counts the message, and returns whether to log it, with the number of the ones dropped in the last interval.
+func (f *SamplingFormatter) sample(key string, entry *logrus.Entry) (int, bool) {
+	now := entry.Time
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.counters == nil || len(f.counters) >= maxSampledMessages {
+		f.counters = make(map[string]*sampleCounter)
+	}
+	counter, ok := f.counters[key]
+	if !ok || now.Sub(counter.windowStart) >= f.Interval {
+		suppressed := 0
+		if ok {
+			suppressed = counter.suppressed
+		}
+		f.counters[key] = &sampleCounter{windowStart: now, count: 1, entry: *entry}
+		return suppressed, true
+	}
+	counter.count++
+	if counter.count > f.Burst {
+		counter.suppressed++
+		return 0, false
+	}
+	return 0, true
+}
+
+// formatSummary formats the summary of the messages like entry suppressed in the last interval.
+func (f *SamplingFormatter) formatSummary(entry logrus.Entry, suppressed int, at time.Time) ([]byte, error) {
+	entry.Buffer = nil
+	entry.Time = at
+	entry.Message = fmt.Sprintf("%d identical messages suppressed in %s: %s", suppressed, f.Interval, entry.Message)
+	return f.Formatter.Format(&entry)
+}
+
+// Flush writes the summaries of the messages suppressed in the intervals ended before now to w,
+// so that they are not lost if the messages are not logged again.
+func (f *SamplingFormatter) Flush(w io.Writer, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, counter := range f.counters {
+		if now.Sub(counter.windowStart) < f.Interval {
+			continue
+		}
+		delete(f.counters, key)
+		if counter.suppressed == 0 {
+			continue
+		}
+		b, err := f.formatSummary(counter.entry, counter.suppressed, now)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartFlushing flushes the summaries to w every Interval until stop is called, which waits for the flushing to end.
+func (f *SamplingFormatter) StartFlushing(w io.Writer) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(f.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				_ = f.Flush(w, now)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-finished
+	}
+}
@@ -60,6 +60,13 @@ func init() {
 
 type TraceIdKey struct{}
 
+// ActorKey is the context key of the user or operator on behalf of whom the logged action is done
+type ActorKey struct{}
+
+// ClaimedOperatorKey is the context key of the operator a request claims to be done on behalf of, it is not
+// authenticated, so it is logged apart from the actor
+type ClaimedOperatorKey struct{}
+
 // field alias
 type FieldMap map[string]string
 
@@ -226,6 +233,11 @@ func (f *TextFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 		}
 	}
 
+	if entry.Context != nil {
+		// the fields set by ContextHook are printed from the context in place of the trace id, or as the duration
+		delete(data, FieldKeyTraceId)
+		delete(data, FieldKeyStartTime)
+	}
 	prefixFieldClashes(data, f.FieldMap, entry.HasCaller())
 	keys := make([]string, 0, len(data))
 	for k := range data {
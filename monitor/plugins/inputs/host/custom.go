@@ -77,6 +77,9 @@ func (c *CustomInput) Init(ctx context.Context, config map[string]interface{}) e
 	if err != nil {
 		return errors.Wrap(err, "process input decode config")
 	}
+	if pluginConfig.Timeout < 0 {
+		return errors.Errorf("process input invalid timeout %s", pluginConfig.Timeout)
+	}
 	c.Config = &pluginConfig
 	c.LibShell = shell.ShellImpl{}
 	c.ctx = ctx
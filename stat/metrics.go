@@ -21,6 +21,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/oceanbase/obagent/config"
+	"github.com/oceanbase/obagent/lib/shell"
 )
 
 var (
@@ -74,6 +75,9 @@ func RegisterStat(ctx context.Context) {
 		LogTailerReadingFileId,
 		LogTailerProcessQueueSize,
 	)
+	if err := shell.RegisterMetrics(registerer); err != nil {
+		log.WithContext(ctx).WithError(err).Error("register shell command metrics failed")
+	}
 
 	gatherPtr, _ := defaultGatherer.(*prometheus.Registry)
 	*gatherPtr = *registry